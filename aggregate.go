@@ -0,0 +1,167 @@
+package simplehstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Aggregations over a property across all owners, computed by the database.
+//
+// CountBy and CountWithKey work both with encoded values and in raw UTF-8 mode,
+// since the encoding of a value is always the same. Sum, Avg, Min and Max need
+// to interpret the values as numbers, and return ErrNotRawUTF8 if the values
+// are encoded (see Host.SetRawUTF8). Values that are not numbers are ignored.
+
+// valueSource is an SQL query that returns the values for a property across all owners, in the "v" column,
+// together with the arguments for the query
+type valueSource struct {
+	host  *Host
+	query string
+	args  []interface{}
+}
+
+// valueSource returns the values for the given key, across all owners
+func (h *HashMap) valueSource(key string) valueSource {
+	return valueSource{h.host, fmt.Sprintf("SELECT attr -> '%s' AS v FROM %s WHERE attr ? '%s' AND NOT %s", escapeSingleQuotes(key), h.table, escapeSingleQuotes(key), h.expired()), nil}
+}
+
+// valueSource returns the values for the given key, across all owners
+func (hm2 *HashMap2) valueSource(key string) valueSource {
+	kv := hm2.keyValue()
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	return valueSource{hm2.host, fmt.Sprintf("SELECT e.value AS v FROM %s, LATERAL each(attr) e WHERE e.key LIKE $1 AND NOT %s", table, expired(table, "e.key")), []interface{}{"%" + escapeLike(fieldSep+key)}}
+}
+
+// countBy counts the number of owners for each distinct value
+func (src valueSource) countBy() (map[string]int64, error) {
+	results := make(map[string]int64)
+	query := fmt.Sprintf("SELECT v, COUNT(*) FROM (%s) AS temp GROUP BY v", src.query)
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := src.host.db.Query(query, src.args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			value sql.NullString
+			count int64
+		)
+		if err := rows.Scan(&value, &count); err != nil {
+			return results, err
+		}
+		s := value.String
+		if !src.host.rawUTF8 {
+			Decode(&s)
+		}
+		results[s] += count
+	}
+	return results, rows.Err()
+}
+
+// aggregate applies an SQL aggregate function to the values
+func (src valueSource) aggregate(function string, numeric bool) (sql.NullFloat64, error) {
+	var result sql.NullFloat64
+	expr := "v"
+	if numeric {
+		if !src.host.rawUTF8 {
+			return result, ErrNotRawUTF8
+		}
+		expr = numericExpr("v")
+	}
+	query := fmt.Sprintf("SELECT %s(%s) FROM (%s) AS temp", function, expr, src.query)
+	if Verbose {
+		fmt.Println(query)
+	}
+	err := src.host.db.QueryRow(query, src.args...).Scan(&result)
+	return result, err
+}
+
+// number applies an SQL aggregate function to the numeric values, and returns
+// ErrNoAvailableValues if there are no numeric values
+func (src valueSource) number(function string) (float64, error) {
+	result, err := src.aggregate(function, true)
+	if err != nil {
+		return 0, err
+	}
+	if !result.Valid {
+		return 0, ErrNoAvailableValues
+	}
+	return result.Float64, nil
+}
+
+// CountBy counts how many owners have each of the values for the given key
+func (h *HashMap) CountBy(key string) (map[string]int64, error) {
+	return h.valueSource(key).countBy()
+}
+
+// CountWithKey counts how many owners have the given key
+func (h *HashMap) CountWithKey(key string) (int64, error) {
+	result, err := h.valueSource(key).aggregate("COUNT", false)
+	return int64(result.Float64), err
+}
+
+// Sum returns the sum of the numeric values for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) Sum(key string) (float64, error) {
+	result, err := h.valueSource(key).aggregate("SUM", true)
+	return result.Float64, err
+}
+
+// Avg returns the average of the numeric values for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) Avg(key string) (float64, error) {
+	return h.valueSource(key).number("AVG")
+}
+
+// Min returns the smallest numeric value for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) Min(key string) (float64, error) {
+	return h.valueSource(key).number("MIN")
+}
+
+// Max returns the largest numeric value for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) Max(key string) (float64, error) {
+	return h.valueSource(key).number("MAX")
+}
+
+// CountBy counts how many owners have each of the values for the given key
+func (hm2 *HashMap2) CountBy(key string) (map[string]int64, error) {
+	return hm2.valueSource(key).countBy()
+}
+
+// CountWithKey counts how many owners have the given key
+func (hm2 *HashMap2) CountWithKey(key string) (int64, error) {
+	result, err := hm2.valueSource(key).aggregate("COUNT", false)
+	return int64(result.Float64), err
+}
+
+// Sum returns the sum of the numeric values for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (hm2 *HashMap2) Sum(key string) (float64, error) {
+	result, err := hm2.valueSource(key).aggregate("SUM", true)
+	return result.Float64, err
+}
+
+// Avg returns the average of the numeric values for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (hm2 *HashMap2) Avg(key string) (float64, error) {
+	return hm2.valueSource(key).number("AVG")
+}
+
+// Min returns the smallest numeric value for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (hm2 *HashMap2) Min(key string) (float64, error) {
+	return hm2.valueSource(key).number("MIN")
+}
+
+// Max returns the largest numeric value for the given key, across all owners.
+// Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (hm2 *HashMap2) Max(key string) (float64, error) {
+	return hm2.valueSource(key).number("MAX")
+}
@@ -0,0 +1,119 @@
+package simplehstore
+
+import (
+	"testing"
+)
+
+func TestHashMapAggregate(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.SetMap("alice", map[string]string{"plan": "pro", "credits": "10"})
+	hashmap.SetMap("bob", map[string]string{"plan": "free", "credits": "2.5"})
+	hashmap.SetMap("carol", map[string]string{"plan": "pro"})
+
+	// Counting works with encoded values
+	counts, err := hashmap.CountBy("plan")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(counts) != 2 || counts["pro"] != 2 || counts["free"] != 1 {
+		t.Errorf("Error, wrong counts: %v", counts)
+	}
+	if n, err := hashmap.CountWithKey("credits"); err != nil {
+		t.Error(err)
+	} else if n != 2 {
+		t.Errorf("Error, expected 2 owners with credits, got %d", n)
+	}
+	if _, err := hashmap.Sum("credits"); err != ErrNotRawUTF8 {
+		t.Errorf("Error, expected ErrNotRawUTF8, got %v", err)
+	}
+}
+
+func TestHashMapAggregateRaw(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	host.SetRawUTF8(true)
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.SetMap("alice", map[string]string{"plan": "pro", "credits": "10"})
+	hashmap.SetMap("bob", map[string]string{"plan": "free", "credits": "2.5"})
+	hashmap.SetMap("carol", map[string]string{"plan": "pro", "credits": "n/a"})
+
+	if sum, err := hashmap.Sum("credits"); err != nil {
+		t.Error(err)
+	} else if sum != 12.5 {
+		t.Errorf("Error, expected 12.5, got %f", sum)
+	}
+	if avg, err := hashmap.Avg("credits"); err != nil {
+		t.Error(err)
+	} else if avg != 6.25 {
+		t.Errorf("Error, expected 6.25, got %f", avg)
+	}
+	if min, err := hashmap.Min("credits"); err != nil {
+		t.Error(err)
+	} else if min != 2.5 {
+		t.Errorf("Error, expected 2.5, got %f", min)
+	}
+	if max, err := hashmap.Max("credits"); err != nil {
+		t.Error(err)
+	} else if max != 10 {
+		t.Errorf("Error, expected 10, got %f", max)
+	}
+	if _, err := hashmap.Max("missing"); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues, got %v", err)
+	}
+	if sum, err := hashmap.Sum("missing"); err != nil || sum != 0 {
+		t.Errorf("Error, expected a sum of 0, got %f and %v", sum, err)
+	}
+}
+
+func TestHashMap2Aggregate(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	host.SetRawUTF8(true)
+	hashmap, err := NewHashMap2(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.SetMap("alice", map[string]string{"plan": "pro", "credits": "10"})
+	hashmap.SetMap("bob", map[string]string{"plan": "free", "credits": "5", "xcredits": "100"})
+
+	counts, err := hashmap.CountBy("plan")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(counts) != 2 || counts["pro"] != 1 || counts["free"] != 1 {
+		t.Errorf("Error, wrong counts: %v", counts)
+	}
+	if n, err := hashmap.CountWithKey("credits"); err != nil {
+		t.Error(err)
+	} else if n != 2 {
+		t.Errorf("Error, expected 2 owners with credits, got %d", n)
+	}
+	if sum, err := hashmap.Sum("credits"); err != nil {
+		t.Error(err)
+	} else if sum != 15 {
+		t.Errorf("Error, expected 15, got %f", sum)
+	}
+}
@@ -0,0 +1,93 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CappedList is a List that only keeps the newest elements. When Add, InsertBefore or InsertAfter
+// adds an element beyond the maximum number of elements, the elements at the front of the list are removed.
+// When PushFront does, the elements at the end of the list are removed instead.
+type CappedList struct {
+	*List
+	max int
+}
+
+// NewCappedList creates a new list that keeps at most max elements
+func NewCappedList(host *Host, name string, max int) (*CappedList, error) {
+	if max < 1 {
+		return nil, fmt.Errorf("a capped list must be able to keep at least one element, not %d", max)
+	}
+	l, err := NewList(host, name)
+	if err != nil {
+		return nil, err
+	}
+	return &CappedList{l, max}, nil
+}
+
+// Max returns the maximum number of elements in this list
+func (cl *CappedList) Max() int {
+	return cl.max
+}
+
+// Add an element to the end of the list, and remove the oldest elements beyond the maximum number of elements,
+// in the same transaction. Consumers that wait in BlockingPopFront are notified.
+func (cl *CappedList) Add(value string) error {
+	if !cl.host.rawUTF8 {
+		Encode(&value)
+	}
+	ctx := context.Background()
+	return cl.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if _, err := execWithTransaction(ctx, transaction, cl.addQuery(), value, notifyChannel(cl.table)); err != nil {
+			return err
+		}
+		_, err := execWithTransaction(ctx, transaction, cl.trimQuery(listOrderDesc()))
+		return err
+	})
+}
+
+// trimQuery returns a query that removes the elements beyond the maximum number of elements,
+// keeping the first elements in the given order
+func (cl *CappedList) trimQuery(order string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s ORDER BY %s OFFSET %d)", cl.table, cl.table, order, cl.max)
+}
+
+// insertAndTrim calls insert and removes the elements beyond the maximum number of elements,
+// keeping the first elements in the given order, in the same transaction
+func (cl *CappedList) insertAndTrim(insert func(context.Context, *sql.Tx) error, order string) error {
+	ctx := context.Background()
+	return cl.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := insert(ctx, transaction); err != nil {
+			return err
+		}
+		_, err := execWithTransaction(ctx, transaction, cl.trimQuery(order))
+		return err
+	})
+}
+
+// PushFront adds an element to the start of the list, and removes the elements at the end of the list
+// beyond the maximum number of elements, in the same transaction. Consumers that wait in BlockingPopFront are notified.
+func (cl *CappedList) PushFront(value string) error {
+	return cl.insertAndTrim(func(ctx context.Context, transaction *sql.Tx) error {
+		return cl.pushFrontWithTransaction(ctx, transaction, value)
+	}, listOrder())
+}
+
+// InsertBefore inserts a value right before the first occurrence of pivot, and removes the elements
+// at the front of the list beyond the maximum number of elements, in the same transaction.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (cl *CappedList) InsertBefore(pivot, value string) error {
+	return cl.insertAndTrim(func(ctx context.Context, transaction *sql.Tx) error {
+		return cl.insertNextToWithTransaction(ctx, transaction, pivot, value, false)
+	}, listOrderDesc())
+}
+
+// InsertAfter inserts a value right after the first occurrence of pivot, and removes the elements
+// at the front of the list beyond the maximum number of elements, in the same transaction.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (cl *CappedList) InsertAfter(pivot, value string) error {
+	return cl.insertAndTrim(func(ctx context.Context, transaction *sql.Tx) error {
+		return cl.insertNextToWithTransaction(ctx, transaction, pivot, value, true)
+	}, listOrderDesc())
+}
@@ -0,0 +1,83 @@
+package simplehstore
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/pinterface"
+)
+
+func TestCappedList(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	if _, err := NewCappedList(host, listname, 0); err == nil {
+		t.Error("Error, a capped list with room for no elements should not be allowed")
+	}
+
+	feed, err := NewCappedList(host, listname, 3)
+	if err != nil {
+		t.Error(err)
+	}
+	feed.Clear()
+	defer feed.Remove()
+
+	for i := 1; i <= 5; i++ {
+		if err := feed.Add(strconv.Itoa(i)); err != nil {
+			t.Error(err)
+		}
+		count, err := feed.Count()
+		if err != nil {
+			t.Error(err)
+		}
+		if expected := min(i, feed.Max()); count != expected {
+			t.Errorf("Error, expected %d elements, got %d", expected, count)
+		}
+	}
+	values, err := feed.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 3 || values[0] != "3" || values[2] != "5" {
+		t.Errorf("Error, expected the three newest elements, got %v", values)
+	}
+
+	// Inserting also keeps the list within the maximum number of elements
+	if err := feed.InsertAfter("4", "4.5"); err != nil {
+		t.Error(err)
+	}
+	values, err = feed.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "4,4.5,5" {
+		t.Errorf("Error, unexpected elements after inserting: %v", values)
+	}
+	if err := feed.InsertBefore("4", "3.5"); err != nil {
+		t.Error(err)
+	}
+	values, err = feed.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "4,4.5,5" {
+		t.Errorf("Error, unexpected elements after inserting at the front: %v", values)
+	}
+	// PushFront removes elements from the end instead
+	if err := feed.PushFront("0"); err != nil {
+		t.Error(err)
+	}
+	values, err = feed.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "0,4,4.5" {
+		t.Errorf("Error, unexpected elements after pushing to the front: %v", values)
+	}
+
+	// Check that the capped list qualifies for the IList interface
+	var _ pinterface.IList = feed
+}
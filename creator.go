@@ -39,3 +39,21 @@ func (m *PostgresCreator) NewHashMap(id string) (pinterface.IHashMap, error) {
 func (m *PostgresCreator) NewKeyValue(id string) (pinterface.IKeyValue, error) {
 	return NewKeyValue(m.host, id)
 }
+
+// NewSortedSet can be used to create a new *SortedSet.
+// There is no corresponding interface in pinterface.
+func (m *PostgresCreator) NewSortedSet(id string) (*SortedSet, error) {
+	return NewSortedSet(m.host, id)
+}
+
+// NewQueue can be used to create a new *Queue.
+// There is no corresponding interface in pinterface.
+func (m *PostgresCreator) NewQueue(id string) (*Queue, error) {
+	return NewQueue(m.host, id)
+}
+
+// NewStream can be used to create a new *Stream.
+// There is no corresponding interface in pinterface.
+func (m *PostgresCreator) NewStream(id string) (*Stream, error) {
+	return NewStream(m.host, id)
+}
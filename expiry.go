@@ -0,0 +1,256 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// The kinds of data structures that may have expiring entries
+	expiryKindKeyValue = "kv"
+	expiryKindHashMap  = "hashmap"
+)
+
+var (
+	// ErrNoExpiry is used as an error if a key exists, but has no expiry time
+	ErrNoExpiry = errors.New("no expiry")
+
+	// The name of the table that keeps track of when keys and owners expire
+	expiryTable = "simplehstore_expiry"
+)
+
+// createExpiryTable creates the table that keeps track of expiry times, if it does not already exist
+func (host *Host) createExpiryTable() error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (tbl %s NOT NULL, k %s NOT NULL, kind %s NOT NULL, expires_at TIMESTAMPTZ NOT NULL, PRIMARY KEY (tbl, k))", pq.QuoteIdentifier(expiryTable), defaultStringType, defaultStringType, defaultStringType)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := host.db.Exec(query); err != nil && !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (expires_at)", pq.QuoteIdentifier(expiryTable+"_expires_at_idx"), pq.QuoteIdentifier(expiryTable))
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := host.db.Exec(query); err != nil && !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
+	return nil
+}
+
+// expired returns an SQL condition that is true if the given key expression
+// (a quoted string or a column) has expired for the given quoted table name
+func expired(table, keyExpr string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s e WHERE e.tbl = '%s' AND e.k = %s AND e.expires_at <= now())", pq.QuoteIdentifier(expiryTable), escapeSingleQuotes(table), keyExpr)
+}
+
+// setExpiry sets the expiry time for the given key in the given quoted table name,
+// but only if existsCondition is true for that table.
+func (host *Host) setExpiry(table, kind, key string, ttl time.Duration, existsCondition string) (int64, error) {
+	query := fmt.Sprintf("INSERT INTO %s (tbl, k, kind, expires_at) SELECT $1, $2, $3, now() + make_interval(secs => $4) WHERE EXISTS (SELECT 1 FROM %s WHERE %s) ON CONFLICT (tbl, k) DO UPDATE SET expires_at = EXCLUDED.expires_at", pq.QuoteIdentifier(expiryTable), table, existsCondition)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := host.db.Exec(query, table, key, kind, ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// setExpiryWithTransaction sets the expiry time for the given key in the given quoted table name, as part of a transaction
+func setExpiryWithTransaction(ctx context.Context, transaction *sql.Tx, table, kind, key string, ttl time.Duration) error {
+	query := fmt.Sprintf("INSERT INTO %s (tbl, k, kind, expires_at) VALUES ($1, $2, $3, now() + make_interval(secs => $4)) ON CONFLICT (tbl, k) DO UPDATE SET expires_at = EXCLUDED.expires_at", pq.QuoteIdentifier(expiryTable))
+	_, err := execWithTransaction(ctx, transaction, query, table, key, kind, ttl.Seconds())
+	return err
+}
+
+// ttl returns the remaining time to live for the given key in the given quoted table name,
+// where existsCondition is true for the rows that have the key.
+// An error that wraps ErrKeyDoesNotExist is returned if the key does not exist or has expired,
+// and ErrNoExpiry is returned if the key exists, but has no expiry time.
+func (host *Host) ttl(table, key, existsCondition string) (time.Duration, error) {
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s), (SELECT EXTRACT(EPOCH FROM (expires_at - now())) FROM %s WHERE tbl = $1 AND k = $2)", table, existsCondition, pq.QuoteIdentifier(expiryTable))
+	if Verbose {
+		fmt.Println(query)
+	}
+	var (
+		exists  bool
+		seconds sql.NullFloat64
+	)
+	if err := host.db.QueryRow(query, table, key).Scan(&exists, &seconds); err != nil {
+		return 0, err
+	}
+	if !exists || (seconds.Valid && seconds.Float64 <= 0) {
+		return 0, fmt.Errorf("%w: %s", ErrKeyDoesNotExist, key)
+	}
+	if !seconds.Valid {
+		return 0, ErrNoExpiry
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// persist removes the expiry time for the given key in the given quoted table name.
+// If onlyExpired is true, the expiry time is only removed if it has already passed,
+// and true is returned if it was removed.
+func (host *Host) persist(table, key string, onlyExpired bool) (bool, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable))
+	if onlyExpired {
+		query += " AND expires_at <= now()"
+	}
+	result, err := host.db.Exec(query, table, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// clearExpiry removes all expiry times for the given quoted table name
+func (host *Host) clearExpiry(table string) error {
+	_, err := host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tbl = $1", pq.QuoteIdentifier(expiryTable)), table)
+	return err
+}
+
+// ReapExpired physically removes all expired keys and owners from the KeyValue and HashMap tables.
+// Returns the number of keys and owners that were removed.
+func (host *Host) ReapExpired() (int64, error) {
+	query := fmt.Sprintf("SELECT tbl, k FROM %s WHERE expires_at <= now()", pq.QuoteIdentifier(expiryTable))
+	rows, err := host.db.Query(query)
+	if err != nil {
+		if noResult(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var tables, keys []string
+	for rows.Next() {
+		var table, key string
+		if err := rows.Scan(&table, &key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tables = append(tables, table)
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var counter int64
+	for i := range keys {
+		removed, err := host.reap(tables[i], keys[i])
+		if err != nil {
+			return counter, err
+		}
+		if removed {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+// reap removes a single expired key or owner, in a transaction.
+// Returns true if the key or owner was removed.
+func (host *Host) reap(table, key string) (bool, error) {
+	transaction, err := host.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	// Lock and remove the expiry time, but only if it is still expired
+	var kind string
+	query := fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2 AND expires_at <= now() RETURNING kind", pq.QuoteIdentifier(expiryTable))
+	if err := transaction.QueryRow(query, table, key).Scan(&kind); err != nil {
+		transaction.Rollback()
+		if err == sql.ErrNoRows {
+			// Persisted or given a new expiry time in the meantime
+			return false, nil
+		}
+		return false, err
+	}
+	switch kind {
+	case expiryKindKeyValue:
+		query = fmt.Sprintf("UPDATE %s SET attr = delete(attr, $1)", table)
+	case expiryKindHashMap:
+		query = fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, ownerCol)
+	default:
+		transaction.Rollback()
+		return false, fmt.Errorf("unknown kind of expiring data structure: %s", kind)
+	}
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := transaction.Exec(query, key); err != nil {
+		transaction.Rollback()
+		if noResult(err) {
+			// The table has been removed, only remove the expiry time
+			_, err = host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable)), table, key)
+			return false, err
+		}
+		return false, err
+	}
+	if err := transaction.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StartReaper starts a background goroutine that calls ReapExpired at the given interval,
+// until StopReaper or Close is called. Expired entries are invisible even without a reaper,
+// but will not be physically removed from the database. An interval that is not positive is an error.
+func (host *Host) StartReaper(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("the reaper interval must be positive, not %s", interval)
+	}
+	host.reaperMut.Lock()
+	defer host.reaperMut.Unlock()
+	if host.reaperStop != nil {
+		// Already running
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	host.reaperStop = stop
+	host.reaperDone = done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				n, err := host.ReapExpired()
+				if Verbose {
+					if err != nil {
+						log.Println("Reaper:", err)
+					} else if n > 0 {
+						log.Println("Reaper: removed", n, "expired entries")
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// StopReaper stops the background goroutine started by StartReaper, and waits for it to finish
+func (host *Host) StopReaper() {
+	host.reaperMut.Lock()
+	defer host.reaperMut.Unlock()
+	if host.reaperStop == nil {
+		return
+	}
+	close(host.reaperStop)
+	<-host.reaperDone
+	host.reaperStop = nil
+	host.reaperDone = nil
+}
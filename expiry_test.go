@@ -0,0 +1,66 @@
+package simplehstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReapExpired(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	kv, err := NewKeyValue(host, keyvaluename)
+	if err != nil {
+		t.Error(err)
+	}
+	kv.Clear()
+	defer kv.Remove()
+
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	kv.SetEx("a", "1", -time.Second)
+	kv.Set("b", "2")
+	hashmap.Set("bob", "x", "1")
+	hashmap.ExpireOwner("bob", -time.Second)
+	hashmap.Set("alice", "x", "2")
+
+	n, err := host.ReapExpired()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Errorf("Error, expected 2 reaped entries, got %d", n)
+	}
+
+	// The reaped entries are now physically gone, not only invisible
+	if count, err := kv.Count(); err != nil {
+		t.Error(err)
+	} else if count != 1 {
+		t.Errorf("Error, expected 1 key, got %d", count)
+	}
+	if _, err := host.ttl(hashmap.table, "bob", ownerCol+" = $2"); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, bob should be gone, got %v", err)
+	}
+
+	// Start and stop the background reaper
+	if err := host.StartReaper(0); err == nil {
+		t.Error("Error, should not be able to start a reaper without a positive interval")
+	}
+	kv.SetEx("c", "3", -time.Second)
+	if err := host.StartReaper(10 * time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	host.StopReaper()
+	if _, err := kv.TTL("c"); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, the background reaper should have removed the expired key, got %v", err)
+	}
+}
@@ -1,11 +1,14 @@
 package simplehstore
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -36,36 +39,44 @@ func NewHashMap(host *Host, name string) (*HashMap, error) {
 	if Verbose {
 		log.Println("Created HSTORE table " + h.table + " in database " + host.dbname)
 	}
+	if err := host.createExpiryTable(); err != nil {
+		return nil, err
+	}
 	return h, nil
 }
 
-// CreateIndexTable creates an INDEX table for this hash map, that may speed up lookups
+// CreateIndexTable creates an INDEX table for this hash map, that may speed up lookups.
+// This is the same as h.Indexes().CreateGIN().
 func (h *HashMap) CreateIndexTable() error {
-	// strip double quotes from h.table and add _idx at the end
-	indexTableName := strings.TrimSuffix(strings.TrimPrefix(h.table, "\""), "\"") + "_idx"
-	query := fmt.Sprintf("CREATE INDEX %q ON %s USING GIN (attr)", indexTableName, h.table)
-	if Verbose {
-		fmt.Println(query)
+	ix := h.Indexes()
+	// Older versions named the index after the table name, which could collide with a KeyValue
+	legacyName := pq.QuoteIdentifier(strings.TrimSuffix(strings.TrimPrefix(h.table, "\""), "\"") + "_idx")
+	if err := ix.renameLegacy(legacyName, ix.ginIndexName()); err != nil {
+		return err
 	}
-	_, err := h.host.db.Exec(query)
-	return err
-
+	return ix.CreateGIN()
 }
 
-// RemoveIndexTable removes the INDEX table for this hash map
-func (h *HashMap) RemoveIndexTable(owner string) error {
-	// strip double quotes from h.table and add _idx at the end
-	indexTableName := strings.TrimSuffix(strings.TrimPrefix(h.table, "\""), "\"") + "_idx"
-	query := fmt.Sprintf("DROP INDEX %q", indexTableName)
-	if Verbose {
-		fmt.Println(query)
-	}
-	_, err := h.host.db.Exec(query)
-	return err
+// RemoveIndexTable removes the INDEX table for this hash map.
+// This is the same as h.Indexes().DropGIN().
+func (h *HashMap) RemoveIndexTable() error {
+	return h.Indexes().DropGIN()
 }
 
-// Set a value in a hashmap given the element id (for instance a user id) and the key (for instance "password")
+// Set a value in a hashmap given the element id (for instance a user id) and the key (for instance "password").
+// A *UniqueViolationError is returned if the key must have a unique value (see SetUniqueKey),
+// but the value is already used by another owner.
 func (h *HashMap) Set(owner, key, value string) error {
+	return h.retryUniqueViolation(map[string]string{key: value}, func() error {
+		return h.set(owner, key, value)
+	})
+}
+
+// set a value in a hashmap, without retrying if the value is used by an expired owner
+func (h *HashMap) set(owner, key, value string) error {
+	if err := h.purgeExpired(owner); err != nil {
+		return fmt.Errorf("hashMap Set, purge: %s", err)
+	}
 	if !h.host.rawUTF8 {
 		Encode(&value)
 	}
@@ -73,12 +84,18 @@ func (h *HashMap) Set(owner, key, value string) error {
 	// First try updating the key/values
 	n, err := h.update(owner, key, encodedValue)
 	if err != nil {
+		if err := uniqueViolation(err, h.Indexes(), key); errors.Is(err, ErrUniqueViolation) {
+			return err
+		}
 		return fmt.Errorf("hashMap Set, update: %s", err)
 	}
 	// If no rows are affected (SELECTED) by the update, try inserting a row instead
 	if n == 0 {
 		n, err = h.insert(owner, key, encodedValue)
 		if err != nil {
+			if err := uniqueViolation(err, h.Indexes(), key); errors.Is(err, ErrUniqueViolation) {
+				return err
+			}
 			return fmt.Errorf("hashMap Set, insert: %s", err)
 		}
 		if n == 0 {
@@ -125,6 +142,20 @@ func (h *HashMap) update(owner, key, encodedValue string) (int64, error) {
 // SetCheck will set a value in a hashmap given the element id (for instance a user id) and the key (for instance "password")
 // Returns true if the key already existed.
 func (h *HashMap) SetCheck(owner, key, value string) (bool, error) {
+	var existed bool
+	err := h.retryUniqueViolation(map[string]string{key: value}, func() error {
+		var err error
+		existed, err = h.setCheck(owner, key, value)
+		return err
+	})
+	return existed, err
+}
+
+// setCheck sets a value in a hashmap, without retrying if the value is used by an expired owner
+func (h *HashMap) setCheck(owner, key, value string) (bool, error) {
+	if err := h.purgeExpired(owner); err != nil {
+		return false, err
+	}
 	if !h.host.rawUTF8 {
 		Encode(&value)
 	}
@@ -132,13 +163,13 @@ func (h *HashMap) SetCheck(owner, key, value string) (bool, error) {
 	// First try updating the key/values
 	n, err := h.update(owner, key, encodedValue)
 	if err != nil {
-		return false, err
+		return false, uniqueViolation(err, h.Indexes(), key)
 	}
 	// If no rows are affected (SELECTED) by the update, try inserting a row instead
 	if n == 0 {
 		n, err = h.insert(owner, key, encodedValue)
 		if err != nil {
-			return false, err
+			return false, uniqueViolation(err, h.Indexes(), key)
 		}
 		if n == 0 {
 			return false, errors.New("could not update or insert any rows")
@@ -151,7 +182,7 @@ func (h *HashMap) SetCheck(owner, key, value string) (bool, error) {
 
 // Get a value from a hashmap given the element id (for instance a user id) and the key (for instance "password").
 func (h *HashMap) Get(owner, key string) (string, error) {
-	query := fmt.Sprintf("SELECT attr -> '%s' FROM %s WHERE %s = '%s' AND attr ? '%s'", escapeSingleQuotes(key), h.table, ownerCol, escapeSingleQuotes(owner), escapeSingleQuotes(key))
+	query := fmt.Sprintf("SELECT attr -> '%s' FROM %s WHERE %s = '%s' AND attr ? '%s' AND NOT %s", escapeSingleQuotes(key), h.table, ownerCol, escapeSingleQuotes(owner), escapeSingleQuotes(key), h.expired())
 	if Verbose {
 		fmt.Println(query)
 	}
@@ -189,7 +220,7 @@ func (h *HashMap) Get(owner, key string) (string, error) {
 
 // Has checks if a given owner + key exists in the hash map
 func (h *HashMap) Has(owner, key string) (bool, error) {
-	query := fmt.Sprintf("SELECT attr -> '%s' FROM %s WHERE %s = '%s' AND attr ? '%s'", escapeSingleQuotes(key), h.table, ownerCol, escapeSingleQuotes(owner), escapeSingleQuotes(key))
+	query := fmt.Sprintf("SELECT attr -> '%s' FROM %s WHERE %s = '%s' AND attr ? '%s' AND NOT %s", escapeSingleQuotes(key), h.table, ownerCol, escapeSingleQuotes(owner), escapeSingleQuotes(key), h.expired())
 	if Verbose {
 		fmt.Println(query)
 	}
@@ -224,7 +255,7 @@ func (h *HashMap) Has(owner, key string) (bool, error) {
 
 // Exists checks if a given owner exists as a hash map at all
 func (h *HashMap) Exists(owner string) (bool, error) {
-	query := fmt.Sprintf("SELECT attr FROM %s WHERE %s = '%s'", h.table, ownerCol, escapeSingleQuotes(owner))
+	query := fmt.Sprintf("SELECT attr FROM %s WHERE %s = '%s' AND NOT %s", h.table, ownerCol, escapeSingleQuotes(owner), h.expired())
 	rows, err := h.host.db.Query(query)
 	if err != nil {
 		return false, err
@@ -248,42 +279,13 @@ func (h *HashMap) Exists(owner string) (bool, error) {
 	return counter > 0, nil // found at least one row
 }
 
-// json returns the first found hstore value for the given key as a JSON string
-func (h *HashMap) json(owner string) (string, error) {
-	query := fmt.Sprintf("SELECT hstore_to_json(hstore(array_agg(altering_pairs))) FROM %s, LATERAL unnest(hstore_to_array(attr)) altering_pairs WHERE %s = '%s'", h.table, ownerCol, escapeSingleQuotes(owner))
-	if Verbose {
-		fmt.Println(query)
-	}
-	rows, err := h.host.db.Query(query)
-	if err != nil {
-		return "", err
-	}
-	if rows == nil {
-		return "", ErrNoAvailableValues
-	}
-	defer rows.Close()
-	var value sql.NullString
-	if rows.Next() {
-		if err = rows.Scan(&value); err != nil {
-			return "", err
-		}
-		s := value.String
-		if !h.host.rawUTF8 {
-			Decode(&s)
-		}
-		// Got a value, return it
-		return s, nil
-	}
-	return "", rows.Err()
-}
-
 // All returns all owners for all hash map elements
 func (h *HashMap) All() ([]string, error) {
 	var (
 		values []string
 		value  string
 	)
-	rows, err := h.host.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s", ownerCol, h.table))
+	rows, err := h.host.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE NOT %s", ownerCol, h.table, h.expired()))
 	if err != nil {
 		return values, err
 	}
@@ -314,7 +316,7 @@ func (h *HashMap) AllWhere(key, value string) ([]string, error) {
 	}
 	// Return all owner ID's for all entries that has the given key->value attribute
 	//fmt.Printf("SELECT DISTINCT %s FROM %s WHERE attr @> '\"%s\"=>\"%s\"' :: hstore", ownerCol, h.table, key, value)
-	rows, err := h.host.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE attr @> '\"%s\"=>\"%s\"' :: hstore", ownerCol, h.table, key, value))
+	rows, err := h.host.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE attr @> '\"%s\"=>\"%s\"' :: hstore AND NOT %s", ownerCol, h.table, key, value, h.expired()))
 	if err != nil {
 		return values, err
 	}
@@ -340,7 +342,7 @@ func (h *HashMap) AllWhere(key, value string) ([]string, error) {
 // Count counts the number of owners for hash map elements
 func (h *HashMap) Count() (int, error) {
 	var value sql.NullInt32
-	rows, err := h.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", ownerCol, h.table))
+	rows, err := h.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s WHERE NOT %s) as temp", ownerCol, h.table, h.expired()))
 	if err != nil {
 		return 0, err
 	}
@@ -359,7 +361,7 @@ func (h *HashMap) Count() (int, error) {
 // CountInt64 counts the number of owners for hash map elements
 func (h *HashMap) CountInt64() (int64, error) {
 	var value sql.NullInt64
-	rows, err := h.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", ownerCol, h.table))
+	rows, err := h.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s WHERE NOT %s) as temp", ownerCol, h.table, h.expired()))
 	if err != nil {
 		return 0, err
 	}
@@ -375,14 +377,114 @@ func (h *HashMap) CountInt64() (int64, error) {
 	return value.Int64, nil
 }
 
-// GetAll is deprecated in favor of All
-func (h *HashMap) GetAll() ([]string, error) {
-	return h.All()
+// SetMap sets many keys and values for the given owner, with a single query.
+// A *UniqueViolationError is returned if a key must have a unique value (see SetUniqueKey),
+// but the value is already used by another owner.
+func (h *HashMap) SetMap(owner string, m map[string]string) error {
+	return h.retryUniqueViolation(m, func() error {
+		return h.setMap(owner, m)
+	})
+}
+
+// setMap sets several values in a hashmap, without retrying if a value is used by an expired owner
+func (h *HashMap) setMap(owner string, m map[string]string) error {
+	if len(m) == 0 {
+		return nil
+	}
+	if err := h.purgeExpired(owner); err != nil {
+		return fmt.Errorf("hashMap SetMap, purge: %s", err)
+	}
+	keys := make([]string, 0, len(m))
+	values := make([]string, 0, len(m))
+	for k, v := range m {
+		if !h.host.rawUTF8 {
+			Encode(&v)
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	// Update the rows that already have one or more of the keys, then insert one row per remaining key
+	query := fmt.Sprintf("WITH input AS (SELECT * FROM unnest($2::text[], $3::text[]) AS i(k, v)), u AS (UPDATE %s SET attr = attr || slice(hstore($2::text[], $3::text[]), akeys(attr)) WHERE %s = $1 AND attr ?| $2::text[] RETURNING akeys(attr) AS ks) INSERT INTO %s (%s, attr) SELECT $1, hstore(input.k, input.v) FROM input WHERE NOT EXISTS (SELECT 1 FROM u WHERE input.k = ANY(u.ks))", h.table, ownerCol, h.table, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := h.host.db.Exec(query, owner, pq.Array(keys), pq.Array(values))
+	return uniqueViolation(err, h.Indexes(), keys...)
+}
+
+// getMap retrieves keys and values for the given owner, with a single query.
+// If keys is nil, all keys and values are retrieved.
+func (h *HashMap) getMap(owner string, keys []string) (map[string]string, error) {
+	results := make(map[string]string)
+	attr := "attr"
+	args := []interface{}{owner}
+	if keys != nil {
+		attr = "slice(attr, $2::text[])"
+		args = append(args, pq.Array(keys))
+	}
+	query := fmt.Sprintf("SELECT key, value FROM %s, LATERAL each(%s) WHERE %s = $1 AND NOT %s", h.table, attr, ownerCol, h.expired())
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := h.host.db.Query(query, args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key   string
+			value sql.NullString
+		)
+		if err := rows.Scan(&key, &value); err != nil {
+			return results, err
+		}
+		s := value.String
+		if !h.host.rawUTF8 {
+			Decode(&s)
+		}
+		results[key] = s
+	}
+	return results, rows.Err()
+}
+
+// GetMap retrieves multiple values for the given owner, with a single query.
+// If one of the keys does not exist, the found values are returned together with an error.
+func (h *HashMap) GetMap(owner string, keys []string) (map[string]string, error) {
+	results, err := h.getMap(owner, keys)
+	if err != nil {
+		return results, err
+	}
+	for _, key := range keys {
+		if _, found := results[key]; !found {
+			return results, fmt.Errorf("%w: %s", ErrKeyDoesNotExist, key)
+		}
+	}
+	return results, nil
+}
+
+// GetAll retrieves all keys and values for the given owner, with a single query.
+// Use All for retrieving all owners.
+func (h *HashMap) GetAll(owner string) (map[string]string, error) {
+	return h.getMap(owner, nil)
+}
+
+// JSON returns all keys and values for the given owner, as a JSON object
+func (h *HashMap) JSON(owner string) (string, error) {
+	m, err := h.GetAll(owner)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // Keys returns all keys for a given owner
 func (h *HashMap) Keys(owner string) ([]string, error) {
-	rows, err := h.host.db.Query(fmt.Sprintf("SELECT skeys(attr) FROM %s WHERE %s = '%s'", h.table, ownerCol, escapeSingleQuotes(owner)))
+	rows, err := h.host.db.Query(fmt.Sprintf("SELECT skeys(attr) FROM %s WHERE %s = '%s' AND NOT %s", h.table, ownerCol, escapeSingleQuotes(owner), h.expired()))
 	if err != nil {
 		return []string{}, err
 	}
@@ -417,6 +519,18 @@ func (h *HashMap) DelKey(owner, key string) error {
 	return err
 }
 
+// delKeysWithTransaction removes the given keys from the rows that match the condition, with a transaction.
+// Rows that are left without any keys are removed, so that they are not counted as owners.
+// The keys are $1 in the condition, and the arguments are $2 and up.
+func (h *HashMap) delKeysWithTransaction(ctx context.Context, transaction *sql.Tx, keys []string, condition string, args ...interface{}) error {
+	args = append([]interface{}{pq.Array(keys)}, args...)
+	if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE attr ?| $1::text[] AND delete(attr, $1::text[]) = ''::hstore AND (%s)", h.table, condition), args...); err != nil {
+		return err
+	}
+	_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET attr = delete(attr, $1::text[]) WHERE attr ?| $1::text[] AND (%s)", h.table, condition), args...)
+	return err
+}
+
 // Del removes an element (for instance a user)
 func (h *HashMap) Del(owner string) error {
 	// Remove an element id from the table
@@ -431,7 +545,8 @@ func (h *HashMap) Del(owner string) error {
 	if Verbose {
 		log.Println(n, "rows were deleted with Del("+owner+")!")
 	}
-	return nil
+	_, err = h.host.persist(h.table, owner, false)
+	return err
 }
 
 // Remove this hashmap
@@ -439,8 +554,10 @@ func (h *HashMap) Remove() error {
 	// Remove the table
 	q := fmt.Sprintf("DROP TABLE %s", h.table)
 	log.Println(q)
-	_, err := h.host.db.Exec(q)
-	return err
+	if _, err := h.host.db.Exec(q); err != nil {
+		return err
+	}
+	return h.host.clearExpiry(h.table)
 }
 
 // Clear the contents
@@ -450,6 +567,165 @@ func (h *HashMap) Clear() error {
 		fmt.Println(query)
 	}
 	// Clear the table
+	if _, err := h.host.db.Exec(query); err != nil {
+		return err
+	}
+	return h.host.clearExpiry(h.table)
+}
+
+// expired returns an SQL condition that is true if the owner of the current row has expired
+func (h *HashMap) expired() string {
+	return expired(h.table, h.table+"."+ownerCol)
+}
+
+// purgeExpiredQuery returns a query that removes all keys for an owner if the owner has expired.
+// The arguments are the table name and the owner.
+func (h *HashMap) purgeExpiredQuery() string {
+	return fmt.Sprintf("WITH e AS (DELETE FROM %s WHERE tbl = $1 AND k = $2 AND expires_at <= now() RETURNING k) DELETE FROM %s WHERE %s IN (SELECT k FROM e)", pq.QuoteIdentifier(expiryTable), h.table, ownerCol)
+}
+
+// purgeExpired removes all keys for the given owner, if the owner has expired
+func (h *HashMap) purgeExpired(owner string) error {
+	query := h.purgeExpiredQuery()
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := h.host.db.Exec(query, h.table, owner)
+	return err
+}
+
+// ExpireOwner makes all keys for the given owner expire after the given duration.
+// Expired owners are invisible right away, and are physically removed by the reaper (see Host.StartReaper).
+func (h *HashMap) ExpireOwner(owner string, ttl time.Duration) error {
+	n, err := h.host.setExpiry(h.table, expiryKindHashMap, owner, ttl, ownerCol+" = $2 AND NOT "+h.expired())
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrOwnerDoesNotExist, owner)
+	}
+	return nil
+}
+
+// ScanKeys returns a Scanner that iterates over all keys for the given owner that
+// match the given Redis-style glob pattern (with *, ?, [abc] and \ for escaping)
+func (h *HashMap) ScanKeys(owner, pattern string) *Scanner {
+	op, arg := globMatch(pattern)
+	query := fmt.Sprintf("SELECT DISTINCT k FROM (SELECT skeys(attr) AS k FROM %s WHERE %s = $4 AND NOT %s) AS temp WHERE k > $1 AND k %s $2 ORDER BY k LIMIT $3", h.table, ownerCol, h.expired(), op)
+	return newScanner(context.Background(), defaultScanPageSize, func(ctx context.Context, cursor string, limit int) ([]string, error) {
+		return scanStrings(ctx, h.host, query, cursor, arg, limit, owner)
+	})
+}
+
+// ScanOwners returns a Scanner that iterates over all owners that match
+// the given Redis-style glob pattern (with *, ?, [abc] and \ for escaping)
+func (h *HashMap) ScanOwners(pattern string) *Scanner {
+	op, arg := globMatch(pattern)
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s > $1 AND %s %s $2 AND NOT %s ORDER BY %s LIMIT $3", ownerCol, h.table, ownerCol, ownerCol, op, h.expired(), ownerCol)
+	return newScanner(context.Background(), defaultScanPageSize, func(ctx context.Context, cursor string, limit int) ([]string, error) {
+		return scanStrings(ctx, h.host, query, cursor, arg, limit)
+	})
+}
+
+// ownersWhere returns all owner ID's where the given SQL condition is true, for the row that has the given key
+func (h *HashMap) ownersWhere(key, condition string, args ...interface{}) ([]string, error) {
+	if !h.host.rawUTF8 {
+		return []string{}, ErrNotRawUTF8
+	}
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE attr ? '%s' AND %s AND NOT %s", ownerCol, h.table, escapeSingleQuotes(key), condition, h.expired())
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := h.host.db.Query(query, args...)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var owner string
+		if err := rows.Scan(&owner); err != nil {
+			return values, err
+		}
+		values = append(values, owner)
+	}
+	return values, rows.Err()
+}
+
+// AllWhereRange returns all owner ID's that has a numeric property where min <= value <= max.
+// Values that are not numbers are ignored. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) AllWhereRange(key string, min, max float64) ([]string, error) {
+	return h.ownersWhere(key, numericValue(key)+" BETWEEN $1 AND $2", min, max)
+}
+
+// AllWhereGreater returns all owner ID's that has a numeric property where value > x.
+// Values that are not numbers are ignored. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) AllWhereGreater(key string, x float64) ([]string, error) {
+	return h.ownersWhere(key, numericValue(key)+" > $1", x)
+}
+
+// AllWhereLess returns all owner ID's that has a numeric property where value < x.
+// Values that are not numbers are ignored. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) AllWhereLess(key string, x float64) ([]string, error) {
+	return h.ownersWhere(key, numericValue(key)+" < $1", x)
+}
+
+// OwnersOrderedBy returns the owner ID's that has the given property, sorted by the value.
+// If numeric is true, the values are sorted as numbers, and owners with values that are not numbers come last.
+// A limit of 0 returns all owners. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) OwnersOrderedBy(key string, numeric, desc bool, limit int) ([]string, error) {
+	if !h.host.rawUTF8 {
+		return []string{}, ErrNotRawUTF8
+	}
+	orderBy := fmt.Sprintf("(attr -> '%s')", escapeSingleQuotes(key))
+	if numeric {
+		orderBy = numericValue(key)
+	}
+	if desc {
+		orderBy += " DESC NULLS LAST"
+	} else {
+		orderBy += " ASC NULLS LAST"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE attr ? '%s' AND NOT %s ORDER BY %s, %s", ownerCol, h.table, escapeSingleQuotes(key), h.expired(), orderBy, ownerCol)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := h.host.db.Query(query)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var owner string
+		if err := rows.Scan(&owner); err != nil {
+			return values, err
+		}
+		values = append(values, owner)
+	}
+	return values, rows.Err()
+}
+
+// CreateNumericIndex creates an expression index for the numeric values of the given key,
+// which can speed up AllWhereRange, AllWhereGreater, AllWhereLess and OwnersOrderedBy.
+func (h *HashMap) CreateNumericIndex(key string) error {
+	query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName(h.table, "num", key), h.table, numericValue(key))
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := h.host.db.Exec(query)
+	return err
+}
+
+// RemoveNumericIndex removes the expression index created by CreateNumericIndex
+func (h *HashMap) RemoveNumericIndex(key string) error {
+	query := fmt.Sprintf("DROP INDEX IF EXISTS %s", indexName(h.table, "num", key))
+	if Verbose {
+		fmt.Println(query)
+	}
 	_, err := h.host.db.Exec(query)
 	return err
 }
@@ -21,11 +21,14 @@ type HashMap2 struct {
 // A string that is unlikely to appear in a key
 const fieldSep = "¤"
 
+// The suffix for the name of the KeyValue table that contains all properties
+const hashMap2PropertiesSuffix = "_properties_HSTORE_map"
+
 // NewHashMap2 creates a new HashMap2 struct
 func NewHashMap2(host *Host, name string) (*HashMap2, error) {
 	var hm2 HashMap2
 	// kv is a KeyValue (HSTORE) table of all properties (key = owner_ID + "¤" + property_key)
-	kv, err := NewKeyValue(host, name+"_properties_HSTORE_map")
+	kv, err := NewKeyValue(host, name+hashMap2PropertiesSuffix)
 	if err != nil {
 		return nil, err
 	}
@@ -105,10 +108,17 @@ func (hm2 *HashMap2) insertPropWithTransaction(ctx context.Context, transaction
 	return err
 }
 
-// SetMap will set many keys/values, in a single transaction
+// SetMap will set many keys/values, in a single transaction.
+// A *UniqueViolationError is returned if a key must have a unique value (see SetUniqueKey),
+// but the value is already used by another owner.
 func (hm2 *HashMap2) SetMap(owner string, m map[string]string) error {
 	checkForFieldSep := true
 
+	uniqueKeys, err := hm2.uniqueKeys()
+	if err != nil {
+		return err
+	}
+
 	// Get all properties
 	propset := hm2.propSet()
 	allProperties, err := propset.All()
@@ -128,6 +138,16 @@ func (hm2 *HashMap2) SetMap(owner string, m map[string]string) error {
 		return err
 	}
 
+	// Register the values for keys that must be unique, before changing anything
+	for k, v := range m {
+		if hasS(uniqueKeys, k) {
+			if err := hm2.claimUniqueValueWithTransaction(ctx, transaction, owner, k, v); err != nil {
+				transaction.Rollback()
+				return err
+			}
+		}
+	}
+
 	insertedKey := ""
 	if isEmpty { // Insert just one key, to initialize the HSTORE value
 		// Prepare the changes
@@ -465,7 +485,10 @@ func (hm2 *HashMap2) Count() (int64, error) {
 func (hm2 *HashMap2) DelKey(owner, key string) error {
 	// The key is not removed from the set of all encountered properties
 	// even if it's the last key with that name, for a performance vs storage tradeoff.
-	return hm2.keyValue().Del(owner + fieldSep + key)
+	if err := hm2.keyValue().Del(owner + fieldSep + key); err != nil {
+		return err
+	}
+	return hm2.delUniqueValues(fmt.Sprintf("k = $1 AND %s = $2", ownerCol), key, owner)
 }
 
 // Del removes an element (for instance a user)
@@ -479,21 +502,24 @@ func (hm2 *HashMap2) Del(owner string) error {
 			return err
 		}
 	}
-	return nil
+	return hm2.delUniqueValues(ownerCol+" = $1", owner)
 }
 
 // Remove this hashmap
 func (hm2 *HashMap2) Remove() error {
 	hm2.propSet().Remove()
+	hm2.uniqueKeySet().Remove()
+	hm2.host.db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", hm2.uniqueValuesTable()))
 	if err := hm2.keyValue().Remove(); err != nil {
 		return fmt.Errorf("could not remove kv: %s", err)
 	}
 	return nil
 }
 
-// Clear the contents
+// Clear the contents. Keys that must have unique values stay that way.
 func (hm2 *HashMap2) Clear() error {
 	hm2.propSet().Clear()
+	hm2.delUniqueValues("TRUE")
 	if err := hm2.keyValue().Clear(); err != nil {
 		return err
 	}
@@ -1,8 +1,10 @@
 package simplehstore
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	// For testing the storage of bcrypt password hashes
 	"golang.org/x/crypto/bcrypt"
@@ -64,7 +66,7 @@ func TestHashMapUserStateShort(t *testing.T) {
 		t.Error("aa should be false, but it is: " + aval)
 	}
 
-	json, err := hashmap.json(username)
+	json, err := hashmap.JSON(username)
 	if err != nil {
 		t.Error(err)
 	}
@@ -75,7 +77,7 @@ func TestHashMapUserStateShort(t *testing.T) {
 		t.Error(err)
 	}
 
-	json, err = hashmap.json(username)
+	json, err = hashmap.JSON(username)
 	if err != nil {
 		t.Error(err)
 	}
@@ -502,3 +504,214 @@ func TestDashesAndQuotes(t *testing.T) {
 		t.Errorf("Error, could not remove hashmap! %s", err)
 	}
 }
+
+func TestHashMapExpireOwner(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.Set("bob", "session", "1")
+	hashmap.Set("bob", "token", "2")
+	hashmap.Set("alice", "session", "3")
+
+	if err := hashmap.ExpireOwner("bob", -time.Second); err != nil {
+		t.Error(err)
+	}
+	if ok, err := hashmap.Has("bob", "session"); err != nil {
+		t.Error(err)
+	} else if ok {
+		t.Error("Error, bob has expired and should be invisible")
+	}
+	if ok, err := hashmap.Exists("bob"); err != nil {
+		t.Error(err)
+	} else if ok {
+		t.Error("Error, bob has expired and should not exist")
+	}
+	owners, err := hashmap.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0] != "alice" {
+		t.Errorf("Error, expected only alice, got %v", owners)
+	}
+
+	// Setting a key for an expired owner starts afresh
+	if err := hashmap.Set("bob", "session", "4"); err != nil {
+		t.Error(err)
+	}
+	keys, err := hashmap.Keys("bob")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 || keys[0] != "session" {
+		t.Errorf("Error, expected only the session key, got %v", keys)
+	}
+
+	if err := hashmap.ExpireOwner("nobody", time.Hour); !errors.Is(err, ErrOwnerDoesNotExist) {
+		t.Errorf("Error, expected ErrOwnerDoesNotExist, got %v", err)
+	}
+}
+
+func TestHashMapScan(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.Set("bob", "email", "bob@example.com")
+	hashmap.Set("bob", "email_confirmed", "true")
+	hashmap.Set("bob", "password", "hunter1")
+	hashmap.Set("bobby", "email", "bobby@example.com")
+	hashmap.Set("alice", "email", "alice@example.com")
+
+	keys, err := hashmap.ScanKeys("bob", "email*").All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 2 || keys[0] != "email" || keys[1] != "email_confirmed" {
+		t.Errorf("Error, wrong keys: %v", keys)
+	}
+	owners, err := hashmap.ScanOwners("bob*").All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 2 || owners[0] != "bob" || owners[1] != "bobby" {
+		t.Errorf("Error, wrong owners: %v", owners)
+	}
+	owners, err = hashmap.ScanOwners("[ab]?i*").All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0] != "alice" {
+		t.Errorf("Error, wrong owners: %v", owners)
+	}
+}
+
+func TestHashMapSetMap(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.Set("bob", "email", "old@example.com")
+	if err := hashmap.SetMap("bob", map[string]string{"email": "bob@example.com", "name": "Bob's", "age": "42"}); err != nil {
+		t.Error(err)
+	}
+	if keys, err := hashmap.Keys("bob"); err != nil {
+		t.Error(err)
+	} else if len(keys) != 3 {
+		t.Errorf("Error, expected 3 keys, got %v", keys)
+	}
+
+	m, err := hashmap.GetMap("bob", []string{"email", "name"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(m) != 2 || m["email"] != "bob@example.com" || m["name"] != "Bob's" {
+		t.Errorf("Error, wrong values: %v", m)
+	}
+	if _, err := hashmap.GetMap("bob", []string{"email", "phone"}); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got %v", err)
+	}
+
+	all, err := hashmap.GetAll("bob")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(all) != 3 || all["age"] != "42" {
+		t.Errorf("Error, wrong values: %v", all)
+	}
+
+	s, err := hashmap.JSON("bob")
+	if err != nil {
+		t.Error(err)
+	}
+	if s != `{"age":"42","email":"bob@example.com","name":"Bob's"}` {
+		t.Errorf("Error, wrong JSON: %s", s)
+	}
+}
+
+func TestHashMapRanges(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.Set("alice", "age", "17")
+	if _, err := hashmap.AllWhereRange("age", 18, 30); err != ErrNotRawUTF8 {
+		t.Errorf("Error, expected ErrNotRawUTF8 in encoded mode, got %v", err)
+	}
+	hashmap.Clear()
+
+	host.SetRawUTF8(true)
+	defer host.SetRawUTF8(false)
+
+	hashmap.Set("alice", "age", "17")
+	hashmap.Set("bob", "age", "18")
+	hashmap.Set("carol", "age", "30.5")
+	hashmap.Set("dave", "age", "unknown")
+	hashmap.Set("erin", "age", "1e1")
+
+	if err := hashmap.CreateNumericIndex("age"); err != nil {
+		t.Error(err)
+	}
+	defer hashmap.RemoveNumericIndex("age")
+
+	owners, err := hashmap.AllWhereRange("age", 18, 30)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0] != "bob" {
+		t.Errorf("Error, expected only bob, got %v", owners)
+	}
+	if owners, err := hashmap.AllWhereGreater("age", 18); err != nil {
+		t.Error(err)
+	} else if len(owners) != 1 || owners[0] != "carol" {
+		t.Errorf("Error, expected only carol, got %v", owners)
+	}
+	if owners, err := hashmap.AllWhereLess("age", 17.5); err != nil {
+		t.Error(err)
+	} else if len(owners) != 2 {
+		t.Errorf("Error, expected alice and erin, got %v", owners)
+	}
+
+	owners, err = hashmap.OwnersOrderedBy("age", true, true, 3)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 3 || owners[0] != "carol" || owners[1] != "bob" || owners[2] != "alice" {
+		t.Errorf("Error, wrong order: %v", owners)
+	}
+	owners, err = hashmap.OwnersOrderedBy("age", true, false, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 5 || owners[0] != "erin" || owners[4] != "dave" {
+		t.Errorf("Error, wrong order: %v", owners)
+	}
+}
@@ -0,0 +1,190 @@
+package simplehstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Indexes can create, drop and list the indexes for the table of a HashMap, HashMap2 or KeyValue.
+// The index names are deterministic, and include both the table name and a hash,
+// so that the indexes of different tables can never collide.
+type Indexes struct {
+	host         *Host
+	table        string // quoted table name
+	ownerColumn  string // empty if the table has no owner column
+	concurrently bool
+}
+
+// Indexes returns an Indexes struct for managing the indexes of this hash map
+func (h *HashMap) Indexes() *Indexes {
+	return &Indexes{host: h.host, table: h.table, ownerColumn: ownerCol}
+}
+
+// Indexes returns an Indexes struct for managing the indexes of this key/value
+func (kv *KeyValue) Indexes() *Indexes {
+	return &Indexes{host: kv.host, table: pq.QuoteIdentifier(kvPrefix + kv.table)}
+}
+
+// Indexes returns an Indexes struct for managing the indexes of the key/value table for this hash map
+func (hm2 *HashMap2) Indexes() *Indexes {
+	return hm2.keyValue().Indexes()
+}
+
+// Concurrently returns a copy of this Indexes struct that creates and drops indexes
+// with CONCURRENTLY, which does not lock the table for writes, but takes longer.
+func (ix *Indexes) Concurrently() *Indexes {
+	concurrentIndexes := *ix
+	concurrentIndexes.concurrently = true
+	return &concurrentIndexes
+}
+
+// create creates an index with the given name, if it does not already exist
+func (ix *Indexes) create(name, unique, definition string) error {
+	concurrently := ""
+	if ix.concurrently {
+		concurrently = "CONCURRENTLY "
+	}
+	query := fmt.Sprintf("CREATE %sINDEX %sIF NOT EXISTS %s ON %s %s", unique, concurrently, name, ix.table, definition)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := ix.host.db.Exec(query)
+	return err
+}
+
+// drop removes an index with the given name, if it exists
+func (ix *Indexes) drop(name string) error {
+	concurrently := ""
+	if ix.concurrently {
+		concurrently = "CONCURRENTLY "
+	}
+	query := fmt.Sprintf("DROP INDEX %sIF EXISTS %s", concurrently, name)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := ix.host.db.Exec(query)
+	return err
+}
+
+// ownerIndexName returns the name of the B-tree index on the owner column
+func (ix *Indexes) ownerIndexName() string {
+	return indexName(ix.table, "owner")
+}
+
+// ginIndexName returns the name of the GIN index on the hstore column
+func (ix *Indexes) ginIndexName() string {
+	return indexName(ix.table, "gin")
+}
+
+// keyIndexName returns the name of the expression index for the given key
+func (ix *Indexes) keyIndexName(key string) string {
+	return indexName(ix.table, "key", key)
+}
+
+// uniqueKeyIndexName returns the name of the unique expression index for the given key
+func (ix *Indexes) uniqueKeyIndexName(key string) string {
+	return indexName(ix.table, "unique", key)
+}
+
+// CreateOwnerIndex creates a B-tree index on the owner column, which speeds up lookups by owner
+func (ix *Indexes) CreateOwnerIndex() error {
+	if ix.ownerColumn == "" {
+		return errors.New("this table has no owner column")
+	}
+	return ix.create(ix.ownerIndexName(), "", fmt.Sprintf("(%s)", ix.ownerColumn))
+}
+
+// DropOwnerIndex removes the index created by CreateOwnerIndex
+func (ix *Indexes) DropOwnerIndex() error {
+	return ix.drop(ix.ownerIndexName())
+}
+
+// CreateGIN creates a GIN index on the hstore column, which speeds up the @>, ?, ?& and ?| operators
+func (ix *Indexes) CreateGIN() error {
+	return ix.create(ix.ginIndexName(), "", "USING GIN (attr)")
+}
+
+// DropGIN removes the index created by CreateGIN
+func (ix *Indexes) DropGIN() error {
+	return ix.drop(ix.ginIndexName())
+}
+
+// CreateKeyIndex creates an expression index on the value of the given key, like (attr -> 'email')
+func (ix *Indexes) CreateKeyIndex(key string) error {
+	return ix.create(ix.keyIndexName(key), "", fmt.Sprintf("((attr -> '%s'))", escapeSingleQuotes(key)))
+}
+
+// DropKeyIndex removes the index created by CreateKeyIndex
+func (ix *Indexes) DropKeyIndex(key string) error {
+	return ix.drop(ix.keyIndexName(key))
+}
+
+// CreateUniqueKeyIndex creates a partial unique expression index on the value of the given key,
+// so that no two rows can have the same value for that key.
+func (ix *Indexes) CreateUniqueKeyIndex(key string) error {
+	return ix.create(ix.uniqueKeyIndexName(key), "UNIQUE ", fmt.Sprintf("((attr -> '%s')) WHERE attr ? '%s'", escapeSingleQuotes(key), escapeSingleQuotes(key)))
+}
+
+// DropUniqueKeyIndex removes the index created by CreateUniqueKeyIndex
+func (ix *Indexes) DropUniqueKeyIndex(key string) error {
+	return ix.drop(ix.uniqueKeyIndexName(key))
+}
+
+// List returns the names of all indexes on the table, sorted by name
+func (ix *Indexes) List() ([]string, error) {
+	rows, err := ix.host.db.Query("SELECT indexrelid::regclass::text AS name FROM pg_index WHERE indrelid = to_regclass($1) ORDER BY name", ix.table)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// lookup returns the name of the given index, as returned by List, if it exists and belongs to this table
+func (ix *Indexes) lookup(name string) (string, bool, error) {
+	var foundName string
+	err := ix.host.db.QueryRow("SELECT indexrelid::regclass::text FROM pg_index WHERE indrelid = to_regclass($1) AND indexrelid = to_regclass($2)", ix.table, name).Scan(&foundName)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return foundName, err == nil, err
+}
+
+// Drop removes the index with the given name, as returned by List.
+// Only indexes on this table can be removed.
+func (ix *Indexes) Drop(name string) error {
+	foundName, found, err := ix.lookup(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no such index on %s: %s", ix.table, name)
+	}
+	return ix.drop(foundName)
+}
+
+// renameLegacy renames an index with an old naming scheme to the given name,
+// but only if the old index exists and belongs to this table
+func (ix *Indexes) renameLegacy(legacyName, name string) error {
+	foundName, found, err := ix.lookup(legacyName)
+	if err != nil || !found {
+		return err
+	}
+	query := fmt.Sprintf("ALTER INDEX %s RENAME TO %s", foundName, name)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err = ix.host.db.Exec(query)
+	return err
+}
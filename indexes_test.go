@@ -0,0 +1,81 @@
+package simplehstore
+
+import (
+	"testing"
+)
+
+func TestIndexes(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	// A HashMap and a KeyValue with the same name must not share index names
+	const sameName = "indexes_test"
+	h, err := NewHashMap(host, sameName)
+	if err != nil {
+		t.Error(err)
+	}
+	defer h.Remove()
+	kv, err := NewKeyValue(host, sameName)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kv.Remove()
+	if err := h.CreateIndexTable(); err != nil {
+		t.Error(err)
+	}
+	// Twice
+	if err := h.CreateIndexTable(); err != nil {
+		t.Error(err)
+	}
+
+	ix := h.Indexes()
+	if err := ix.CreateOwnerIndex(); err != nil {
+		t.Error(err)
+	}
+	if err := ix.CreateKeyIndex("email"); err != nil {
+		t.Error(err)
+	}
+	if err := ix.Concurrently().CreateUniqueKeyIndex("email"); err != nil {
+		t.Error(err)
+	}
+	names, err := ix.List()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(names) != 4 {
+		t.Errorf("Error, expected 4 indexes, got %v", names)
+	}
+	kvNames, err := kv.Indexes().List()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(kvNames) != 1 || hasS(names, kvNames[0]) {
+		t.Errorf("Error, expected a separate GIN index for the key/value, got %v", kvNames)
+	}
+	if err := kv.Indexes().CreateOwnerIndex(); err == nil {
+		t.Error("Error, a key/value has no owner column")
+	}
+
+	if err := ix.DropKeyIndex("email"); err != nil {
+		t.Error(err)
+	}
+	if err := ix.Concurrently().DropUniqueKeyIndex("email"); err != nil {
+		t.Error(err)
+	}
+	if err := ix.Drop(kvNames[0]); err == nil {
+		t.Error("Error, should not be able to drop an index on another table")
+	}
+	if err := ix.Drop(ix.ownerIndexName()); err != nil {
+		t.Error(err)
+	}
+	if err := h.RemoveIndexTable(); err != nil {
+		t.Error(err)
+	}
+	if names, err := ix.List(); err != nil {
+		t.Error(err)
+	} else if len(names) != 0 {
+		t.Errorf("Error, expected no indexes, got %v", names)
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -32,33 +32,32 @@ func NewKeyValue(host *Host, name string) (*KeyValue, error) {
 		log.Println("Created HSTORE table " + pq.QuoteIdentifier(kvPrefix+kv.table) + " in database " + host.dbname)
 	}
 
-	kv.CreateIndexTable()
+	if err := host.createExpiryTable(); err != nil {
+		return nil, err
+	}
+
+	if err := kv.CreateIndexTable(); err != nil {
+		return nil, err
+	}
 
 	return kv, nil
 }
 
-// CreateIndexTable creates an INDEX table for this key/value, that may speed up lookups
+// CreateIndexTable creates an INDEX table for this key/value, that may speed up lookups.
+// This is the same as kv.Indexes().CreateGIN().
 func (kv *KeyValue) CreateIndexTable() error {
-	// strip double quotes from kv.table and add _idx at the end
-	indexTableName := strings.TrimSuffix(strings.TrimPrefix(kv.table, "\""), "\"") + "_idx"
-	query := fmt.Sprintf("CREATE INDEX %q ON %s USING GIN (attr)", indexTableName, pq.QuoteIdentifier(kvPrefix+kv.table))
-	if Verbose {
-		fmt.Println(query)
+	ix := kv.Indexes()
+	// Older versions named the index after the table name without the prefix, which could collide with a HashMap
+	if err := ix.renameLegacy(pq.QuoteIdentifier(kv.table+"_idx"), ix.ginIndexName()); err != nil {
+		return err
 	}
-	_, err := kv.host.db.Exec(query)
-	return err
+	return ix.CreateGIN()
 }
 
-// RemoveIndexTable removes the INDEX table for this key/value
+// RemoveIndexTable removes the INDEX table for this key/value.
+// This is the same as kv.Indexes().DropGIN().
 func (kv *KeyValue) RemoveIndexTable() error {
-	// strip double quotes from kv.table and add _idx at the end
-	indexTableName := strings.TrimSuffix(strings.TrimPrefix(kv.table, "\""), "\"") + "_idx"
-	query := fmt.Sprintf("DROP INDEX %q", indexTableName)
-	if Verbose {
-		fmt.Println(query)
-	}
-	_, err := kv.host.db.Exec(query)
-	return err
+	return kv.Indexes().DropGIN()
 }
 
 // All returns all elements in the set
@@ -67,7 +66,7 @@ func (kv *KeyValue) All() ([]string, error) {
 		values []string
 		value  sql.NullString
 	)
-	query := fmt.Sprintf("SELECT DISTINCT skeys(attr) FROM %s", pq.QuoteIdentifier(kvPrefix+kv.table))
+	query := fmt.Sprintf("SELECT DISTINCT k FROM (SELECT skeys(attr) AS k FROM %s) AS temp WHERE NOT %s", pq.QuoteIdentifier(kvPrefix+kv.table), expired(pq.QuoteIdentifier(kvPrefix+kv.table), "temp.k"))
 	rows, err := kv.host.db.Query(query)
 	if err != nil {
 		return values, err
@@ -158,8 +157,18 @@ func (kv *KeyValue) updateWithTransaction(ctx context.Context, transaction *sql.
 	return n, err
 }
 
-// Set a key and value
+// Set a key and value. Any expiry time for the key is removed.
 func (kv *KeyValue) Set(key, value string) error {
+	return kv.set(key, value, true)
+}
+
+// set a key and value. If persist is true, any expiry time for the key is removed.
+// If not, only expiry times that have already passed are removed.
+func (kv *KeyValue) set(key, value string, persist bool) error {
+	if _, err := kv.host.persist(pq.QuoteIdentifier(kvPrefix+kv.table), key, !persist); err != nil {
+		return err
+	}
+
 	if !kv.host.rawUTF8 {
 		Encode(&value)
 	}
@@ -191,7 +200,7 @@ func (kv *KeyValue) Set(key, value string) error {
 
 // Get a value given a key
 func (kv *KeyValue) Get(key string) (string, error) {
-	rows, err := kv.host.db.Query(fmt.Sprintf("SELECT attr -> '%s' FROM %s", escapeSingleQuotes(key), pq.QuoteIdentifier(kvPrefix+kv.table)))
+	rows, err := kv.host.db.Query(fmt.Sprintf("SELECT CASE WHEN %s THEN NULL ELSE attr -> '%s' END FROM %s", expired(pq.QuoteIdentifier(kvPrefix+kv.table), "'"+escapeSingleQuotes(key)+"'"), escapeSingleQuotes(key), pq.QuoteIdentifier(kvPrefix+kv.table)))
 	if err != nil {
 		return "", fmt.Errorf("KeyValue.Get: query error: %s", err)
 	}
@@ -224,7 +233,7 @@ func (kv *KeyValue) Get(key string) (string, error) {
 		Decode(&s)
 	}
 	if s == "" {
-		return "", fmt.Errorf("key does not exist: %s", key)
+		return "", fmt.Errorf("%w: %s", ErrKeyDoesNotExist, key)
 	}
 	return s, nil
 }
@@ -265,7 +274,7 @@ func (kv *KeyValue) getWithTransaction(ctx context.Context, transaction *sql.Tx,
 		Decode(&s)
 	}
 	if s == "" {
-		return "", fmt.Errorf("key does not exist: %s", key)
+		return "", fmt.Errorf("%w: %s", ErrKeyDoesNotExist, key)
 	}
 	return s, nil
 }
@@ -290,8 +299,8 @@ func (kv *KeyValue) Inc(key string) (string, error) {
 	num++
 	// Convert the new value to a string
 	val := strconv.Itoa(num)
-	// Store the new number
-	if err := kv.Set(key, val); err != nil {
+	// Store the new number, while keeping the expiry time
+	if err := kv.set(key, val, false); err != nil {
 		// Saving the value failed
 		return "0", err
 	}
@@ -318,8 +327,8 @@ func (kv *KeyValue) Dec(key string) (string, error) {
 	num--
 	// Convert the new value to a string
 	val := strconv.Itoa(num)
-	// Store the new number
-	if err := kv.Set(key, val); err != nil {
+	// Store the new number, while keeping the expiry time
+	if err := kv.set(key, val, false); err != nil {
 		// Saving the value failed
 		return "0", err
 	}
@@ -329,28 +338,84 @@ func (kv *KeyValue) Dec(key string) (string, error) {
 
 // Del removes the given key
 func (kv *KeyValue) Del(key string) error {
-	_, err := kv.host.db.Exec(fmt.Sprintf("UPDATE %s SET attr = delete(attr, '%s')", pq.QuoteIdentifier(kvPrefix+kv.table), escapeSingleQuotes(key)))
+	if _, err := kv.host.db.Exec(fmt.Sprintf("UPDATE %s SET attr = delete(attr, '%s')", pq.QuoteIdentifier(kvPrefix+kv.table), escapeSingleQuotes(key))); err != nil {
+		return err
+	}
+	_, err := kv.host.persist(pq.QuoteIdentifier(kvPrefix+kv.table), key, false)
 	return err
 }
 
 // Remove this key/value
 func (kv *KeyValue) Remove() error {
 	// Remove the table
-	_, err := kv.host.db.Exec(fmt.Sprintf("DROP TABLE %s", pq.QuoteIdentifier(kvPrefix+kv.table)))
-	return err
+	if _, err := kv.host.db.Exec(fmt.Sprintf("DROP TABLE %s", pq.QuoteIdentifier(kvPrefix+kv.table))); err != nil {
+		return err
+	}
+	return kv.host.clearExpiry(pq.QuoteIdentifier(kvPrefix + kv.table))
 }
 
 // Clear this key/value
 func (kv *KeyValue) Clear() error {
 	// Truncate the table
-	_, err := kv.host.db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", pq.QuoteIdentifier(kvPrefix+kv.table)))
+	if _, err := kv.host.db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", pq.QuoteIdentifier(kvPrefix+kv.table))); err != nil {
+		return err
+	}
+	return kv.host.clearExpiry(pq.QuoteIdentifier(kvPrefix + kv.table))
+}
+
+// SetEx sets a key and value that expires after the given duration.
+// The value and the expiry time are stored in the same transaction.
+func (kv *KeyValue) SetEx(key, value string, ttl time.Duration) error {
+	if !kv.host.rawUTF8 {
+		Encode(&value)
+	}
+	ctx := context.Background()
+	return kv.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		n, err := kv.updateWithTransaction(ctx, transaction, key, value)
+		if err != nil {
+			return err
+		}
+		if n == 0 { // insert the first one if the KeyValue is currently empty
+			if _, err := kv.insertWithTransaction(ctx, transaction, key, value); err != nil {
+				return err
+			}
+		}
+		return setExpiryWithTransaction(ctx, transaction, pq.QuoteIdentifier(kvPrefix+kv.table), expiryKindKeyValue, key, ttl)
+	})
+}
+
+// Expire makes the given key expire after the given duration.
+// Expired keys are invisible right away, and are physically removed by the reaper (see Host.StartReaper).
+func (kv *KeyValue) Expire(key string, ttl time.Duration) error {
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	n, err := kv.host.setExpiry(table, expiryKindKeyValue, key, ttl, "attr ? $2 AND NOT "+expired(table, "$2"))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrKeyDoesNotExist, key)
+	}
+	return nil
+}
+
+// TTL returns the remaining time to live for the given key.
+// An error that wraps ErrKeyDoesNotExist is returned if the key does not exist or has expired,
+// and ErrNoExpiry is returned if the key has no expiry time.
+func (kv *KeyValue) TTL(key string) (time.Duration, error) {
+	return kv.host.ttl(pq.QuoteIdentifier(kvPrefix+kv.table), key, "attr ? $2")
+}
+
+// Persist removes the expiry time for the given key, if it has not already expired
+func (kv *KeyValue) Persist(key string) error {
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	_, err := kv.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2 AND expires_at > now()", pq.QuoteIdentifier(expiryTable)), table, key)
 	return err
 }
 
 // Count counts the number of keys
 func (kv *KeyValue) Count() (int, error) {
 	var value sql.NullInt32
-	query := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT skeys(attr) FROM %s) as temp", pq.QuoteIdentifier(kvPrefix+kv.table))
+	query := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT k FROM (SELECT skeys(attr) AS k FROM %s) AS keys WHERE NOT %s) as temp", pq.QuoteIdentifier(kvPrefix+kv.table), expired(pq.QuoteIdentifier(kvPrefix+kv.table), "keys.k"))
 	rows, err := kv.host.db.Query(query)
 	if err != nil {
 		return 0, err
@@ -371,7 +436,7 @@ func (kv *KeyValue) Count() (int, error) {
 // CountInt64 counts the number of keys
 func (kv *KeyValue) CountInt64() (int64, error) {
 	var value sql.NullInt64
-	query := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT skeys(attr) FROM %s) as temp", pq.QuoteIdentifier(kvPrefix+kv.table))
+	query := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT k FROM (SELECT skeys(attr) AS k FROM %s) AS keys WHERE NOT %s) as temp", pq.QuoteIdentifier(kvPrefix+kv.table), expired(pq.QuoteIdentifier(kvPrefix+kv.table), "keys.k"))
 	rows, err := kv.host.db.Query(query)
 	if err != nil {
 		return 0, err
@@ -409,3 +474,97 @@ func (kv *KeyValue) Empty() (bool, error) {
 	}
 	return value.Int64 == 0, nil // the count of either 0 elements, or the first 1 elements (LIMIT 1), is empty
 }
+
+// MGet retrieves the values for the given keys, with a single query.
+// Returns the found keys and values, together with the keys that do not exist.
+func (kv *KeyValue) MGet(keys ...string) (map[string]string, []string, error) {
+	results := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return results, []string{}, nil
+	}
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	query := fmt.Sprintf("SELECT key, value FROM %s, LATERAL each(slice(attr, $1::text[])) WHERE NOT %s", table, expired(table, "key"))
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := kv.host.db.Query(query, pq.Array(keys))
+	if err != nil {
+		return results, keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return results, keys, err
+		}
+		s := value.String
+		if !kv.host.rawUTF8 {
+			Decode(&s)
+		}
+		if s == "" {
+			continue
+		}
+		results[key] = s
+	}
+	if err := rows.Err(); err != nil {
+		return results, keys, err
+	}
+	missing := []string{}
+	for _, key := range keys {
+		if _, found := results[key]; !found && !hasS(missing, key) {
+			missing = append(missing, key)
+		}
+	}
+	return results, missing, nil
+}
+
+// MSet sets many keys and values, with a single query.
+// Any expiry times for the keys are removed.
+func (kv *KeyValue) MSet(m map[string]string) error {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	values := make([]string, 0, len(m))
+	for k, v := range m {
+		if !kv.host.rawUTF8 {
+			Encode(&v)
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	// Update the row if it exists, and insert it if not, while removing the expiry times
+	query := fmt.Sprintf("WITH d AS (DELETE FROM %s WHERE tbl = $3 AND k = ANY($1::text[])), u AS (UPDATE %s SET attr = attr || hstore($1::text[], $2::text[]) RETURNING 1) INSERT INTO %s (attr) SELECT hstore($1::text[], $2::text[]) WHERE NOT EXISTS (SELECT 1 FROM u)", pq.QuoteIdentifier(expiryTable), table, table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := kv.host.db.Exec(query, pq.Array(keys), pq.Array(values), table)
+	return err
+}
+
+// MDel removes the given keys, with a single query
+func (kv *KeyValue) MDel(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	query := fmt.Sprintf("WITH d AS (DELETE FROM %s WHERE tbl = $2 AND k = ANY($1::text[])) UPDATE %s SET attr = delete(attr, $1::text[])", pq.QuoteIdentifier(expiryTable), table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := kv.host.db.Exec(query, pq.Array(keys), table)
+	return err
+}
+
+// Scan returns a Scanner that iterates over all keys that match the given
+// Redis-style glob pattern (with *, ?, [abc] and \ for escaping), fetching pageSize keys per query.
+func (kv *KeyValue) Scan(ctx context.Context, pattern string, pageSize int) *Scanner {
+	table := pq.QuoteIdentifier(kvPrefix + kv.table)
+	op, arg := globMatch(pattern)
+	query := fmt.Sprintf("SELECT DISTINCT k FROM (SELECT skeys(attr) AS k FROM %s) AS temp WHERE k > $1 AND k %s $2 AND NOT %s ORDER BY k LIMIT $3", table, op, expired(table, "temp.k"))
+	return newScanner(ctx, pageSize, func(ctx context.Context, cursor string, limit int) ([]string, error) {
+		return scanStrings(ctx, kv.host, query, cursor, arg, limit)
+	})
+}
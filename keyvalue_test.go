@@ -1,7 +1,10 @@
 package simplehstore
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/xyproto/pinterface"
 )
@@ -162,3 +165,149 @@ func TestInc3(t *testing.T) {
 
 	kv.Remove()
 }
+
+func TestKeyValueExpiry(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	kv, err := NewKeyValue(host, keyvaluename)
+	if err != nil {
+		t.Error(err)
+	}
+	kv.Clear()
+
+	if err := kv.SetEx("session", "abc", time.Hour); err != nil {
+		t.Errorf("Error, could not set key with expiry! %s", err)
+	}
+	if ttl, err := kv.TTL("session"); err != nil {
+		t.Error(err)
+	} else if ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Error, wrong TTL: %s", ttl)
+	}
+	if err := kv.Persist("session"); err != nil {
+		t.Error(err)
+	}
+	if _, err := kv.TTL("session"); err != ErrNoExpiry {
+		t.Errorf("Error, expected ErrNoExpiry, got %v", err)
+	}
+	if _, err := kv.TTL("missing"); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist for a missing key, got %v", err)
+	}
+
+	if err := kv.Set("token", "xyz"); err != nil {
+		t.Error(err)
+	}
+	if err := kv.Expire("token", -time.Second); err != nil {
+		t.Error(err)
+	}
+	if _, err := kv.Get("token"); err == nil {
+		t.Error("Error, the expired key should be invisible")
+	}
+	if _, err := kv.TTL("token"); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist for an expired key, got %v", err)
+	}
+	keys, err := kv.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 || keys[0] != "session" {
+		t.Errorf("Error, expected only the session key, got %v", keys)
+	}
+	if err := kv.Expire("token", time.Hour); err == nil {
+		t.Error("Error, should not be able to set an expiry time for an expired key")
+	}
+
+	// Setting an expired key again makes it visible, without an expiry time
+	if err := kv.Set("token", "zyx"); err != nil {
+		t.Error(err)
+	}
+	if val, err := kv.Get("token"); err != nil {
+		t.Error(err)
+	} else if val != "zyx" {
+		t.Errorf("Error, expected zyx, got %s", val)
+	}
+
+	if err := kv.Remove(); err != nil {
+		t.Errorf("Error, could not remove keyvalue! %s", err)
+	}
+}
+
+func TestKeyValueMulti(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	kv, err := NewKeyValue(host, keyvaluename)
+	if err != nil {
+		t.Error(err)
+	}
+	kv.Clear()
+	defer kv.Remove()
+
+	if err := kv.MSet(map[string]string{"a": "1", "b": "2", "c's": "3"}); err != nil {
+		t.Error(err)
+	}
+	if err := kv.MSet(map[string]string{"b": "22"}); err != nil {
+		t.Error(err)
+	}
+	m, missing, err := kv.MGet("a", "b", "c's", "d")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(m) != 3 || m["a"] != "1" || m["b"] != "22" || m["c's"] != "3" {
+		t.Errorf("Error, wrong values: %v", m)
+	}
+	if len(missing) != 1 || missing[0] != "d" {
+		t.Errorf("Error, expected d to be missing, got %v", missing)
+	}
+
+	if err := kv.MDel("a", "b"); err != nil {
+		t.Error(err)
+	}
+	if _, err := kv.Get("a"); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got %v", err)
+	}
+	if count, err := kv.Count(); err != nil {
+		t.Error(err)
+	} else if count != 1 {
+		t.Errorf("Error, expected 1 key, got %d", count)
+	}
+}
+
+func TestKeyValueScan(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	kv, err := NewKeyValue(host, keyvaluename)
+	if err != nil {
+		t.Error(err)
+	}
+	kv.Clear()
+	defer kv.Remove()
+
+	kv.MSet(map[string]string{"user:1": "a", "user:2": "b", "user:10": "c", "user_x": "d", "group:1": "e"})
+
+	keys, err := kv.Scan(context.Background(), "user:*", 2).All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 3 || keys[0] != "user:1" {
+		t.Errorf("Error, wrong keys: %v", keys)
+	}
+	keys, err = kv.Scan(context.Background(), "user:[12]", 0).All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("Error, wrong keys: %v", keys)
+	}
+	keys, err = kv.Scan(context.Background(), "user_?", 0).All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 || keys[0] != "user_x" {
+		t.Errorf("Error, wrong keys: %v", keys)
+	}
+}
@@ -1,10 +1,12 @@
 package simplehstore
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -12,6 +14,22 @@ import (
 // List is a list of strings, stored in PostgreSQL
 type List dbDatastructure
 
+// positionColumn returns the name of the column that decides the order of the elements in a list.
+// The positions are fractional, so that elements can be inserted between other elements without renumbering.
+func positionColumn() string {
+	return pq.QuoteIdentifier(listCol + "_pos")
+}
+
+// listOrder returns an ORDER BY expression for the elements of a list, from first to last
+func listOrder() string {
+	return positionColumn() + ", id"
+}
+
+// listOrderDesc returns an ORDER BY expression for the elements of a list, from last to first
+func listOrderDesc() string {
+	return positionColumn() + " DESC, id DESC"
+}
+
 // NewList creates a new List. Lists are ordered.
 func NewList(host *Host, name string) (*List, error) {
 	l := &List{host, pq.QuoteIdentifier(name)} // name is the name of the table
@@ -23,25 +41,69 @@ func NewList(host *Host, name string) (*List, error) {
 	if Verbose {
 		log.Println("Created table " + l.table + " in database " + host.dbname)
 	}
+	if err := l.createPositionColumn(); err != nil {
+		return nil, err
+	}
 	return l, nil
 }
 
-// Add an element to the list
+// hasColumn checks if the table for this list has the given column
+func (l *List) hasColumn(column string) (bool, error) {
+	var found bool
+	err := l.host.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_attribute WHERE attrelid = to_regclass($1) AND attname = $2 AND NOT attisdropped)", l.table, column).Scan(&found)
+	return found, err
+}
+
+// createPositionColumn adds the position column to lists that were created by older versions.
+// The existing elements keep their order, and new elements are added at the end.
+func (l *List) createPositionColumn() error {
+	found, err := l.hasColumn(listCol + "_pos")
+	if err != nil || found {
+		return err
+	}
+	ctx := context.Background()
+	return l.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		var sequence string
+		if err := transaction.QueryRowContext(ctx, "SELECT pg_get_serial_sequence($1, 'id')", l.table).Scan(&sequence); err != nil {
+			return err
+		}
+		for _, query := range []string{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s DOUBLE PRECISION", l.table, positionColumn()),
+			fmt.Sprintf("UPDATE %s SET %s = id WHERE %s IS NULL", l.table, positionColumn(), positionColumn()),
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT nextval('%s'::regclass)", l.table, positionColumn(), escapeSingleQuotes(sequence)),
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", l.table, positionColumn()),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName(l.table, "position"), l.table, listOrder()),
+		} {
+			if _, err := execWithTransaction(ctx, transaction, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Add an element to the list. Consumers that wait in BlockingPopFront are notified.
 func (l *List) Add(value string) error {
 	if !l.host.rawUTF8 {
 		Encode(&value)
 	}
-	_, err := l.host.db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1)", l.table, listCol), value)
+	_, err := l.host.db.Exec(l.addQuery(), value, notifyChannel(l.table))
 	return err
 }
 
+// addQuery returns a query that adds an encoded value ($1) to the end of the list,
+// and sends a notification on the given channel ($2)
+func (l *List) addQuery() string {
+	return fmt.Sprintf("WITH i AS (INSERT INTO %s (%s) VALUES ($1) RETURNING id) SELECT pg_notify($2, '') FROM i", l.table, listCol)
+}
+
 // All retrieves all elements of a list
 func (l *List) All() ([]string, error) {
 	var (
 		values []string
 		value  sql.NullString
 	)
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY id", listCol, l.table))
+	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", listCol, l.table, listOrder()))
 	if err != nil {
 		return values, err
 	}
@@ -64,16 +126,14 @@ func (l *List) All() ([]string, error) {
 	return values, err
 }
 
-// Has checks if an element exists in the list
-func (l *List) Has(owner string) (bool, error) {
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE id = '%s'", listCol, l.table, owner))
-	if err != nil {
-		return false, err
-	}
-	if rows == nil {
-		return false, ErrNoAvailableValues
+// Has checks if the given value is in the list
+func (l *List) Has(value string) (bool, error) {
+	if !l.host.rawUTF8 {
+		Encode(&value)
 	}
-	return true, nil
+	var found bool
+	err := l.host.db.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1)", l.table, listCol), value).Scan(&found)
+	return found, err
 }
 
 // GetAll is deprecated in favor of All
@@ -84,9 +144,8 @@ func (l *List) GetAll() ([]string, error) {
 // Last retrieves the last element of a list
 func (l *List) Last() (string, error) {
 	var value sql.NullString
-	// Fetches the item with the largest id.
-	// Faster than "ORDER BY id DESC limit 1" for large tables.
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE id = (SELECT MAX(id) FROM %s)", listCol, l.table, l.table))
+	// Fetches the item with the largest position, using the index on the position column
+	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT 1", listCol, l.table, listOrderDesc()))
 	if err != nil {
 		return "", err
 	}
@@ -124,7 +183,7 @@ func (l *List) LastN(n int) ([]string, error) {
 		values []string
 		value  string
 	)
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM (SELECT * FROM %s ORDER BY id DESC limit %d)sub ORDER BY id ASC", listCol, l.table, n))
+	rows, err := l.host.db.Query(fmt.Sprintf("SELECT %s FROM (SELECT * FROM %s ORDER BY %s limit %d)sub ORDER BY %s", listCol, l.table, listOrderDesc(), n, listOrder()))
 	if err != nil {
 		return values, err
 	}
@@ -158,7 +217,7 @@ func (l *List) GetLastN(n int) ([]string, error) {
 
 // RemoveByIndex can remove the Nth item, in the same order as returned by All()
 func (l *List) RemoveByIndex(index int) error {
-	_, err := l.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s ORDER BY id LIMIT 1 OFFSET %d)", l.table, l.table, index))
+	_, err := l.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s ORDER BY %s LIMIT 1 OFFSET %d)", l.table, l.table, listOrder(), index))
 	return err
 }
 
@@ -176,10 +235,10 @@ func (l *List) Clear() error {
 	return err
 }
 
-// Count counts the number of elements in this list
+// Count counts the number of elements in this list, including duplicates
 func (l *List) Count() (int, error) {
 	var value sql.NullInt32
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", listCol, l.table))
+	rows, err := l.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", l.table))
 	if err != nil {
 		return 0, err
 	}
@@ -196,10 +255,10 @@ func (l *List) Count() (int, error) {
 	return int(value.Int32), nil
 }
 
-// CountInt64 counts the number of elements in this list (int64)
+// CountInt64 counts the number of elements in this list, including duplicates (int64)
 func (l *List) CountInt64() (int64, error) {
 	var value sql.NullInt64
-	rows, err := l.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", listCol, l.table))
+	rows, err := l.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", l.table))
 	if err != nil {
 		return 0, err
 	}
@@ -215,3 +274,368 @@ func (l *List) CountInt64() (int64, error) {
 	}
 	return value.Int64, nil
 }
+
+// values runs a query that returns values in the first column, and returns the decoded values
+func (l *List) values(query string, args ...interface{}) ([]string, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	values := []string{}
+	rows, err := l.host.db.Query(query, args...)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			return values, err
+		}
+		s := value.String
+		if !l.host.rawUTF8 {
+			Decode(&s)
+		}
+		values = append(values, s)
+	}
+	return values, rows.Err()
+}
+
+// idAt returns an SQL expression for the id of the element at the given index.
+// A negative index counts from the end of the list, where -1 is the last element.
+func (l *List) idAt(index int) string {
+	if index < 0 {
+		return fmt.Sprintf("(SELECT id FROM %s ORDER BY %s LIMIT 1 OFFSET %d)", l.table, listOrderDesc(), -index-1)
+	}
+	return fmt.Sprintf("(SELECT id FROM %s ORDER BY %s LIMIT 1 OFFSET %d)", l.table, listOrder(), index)
+}
+
+// Get returns the element at the given index, like LINDEX in Redis.
+// A negative index counts from the end of the list, where -1 is the last element.
+// ErrIndexOutOfRange is returned if there is no element at the index.
+func (l *List) Get(index int) (string, error) {
+	values, err := l.values(fmt.Sprintf("SELECT %s FROM %s WHERE id = %s", listCol, l.table, l.idAt(index)))
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrIndexOutOfRange
+	}
+	return values[0], nil
+}
+
+// SetAt replaces the element at the given index, like LSET in Redis.
+// A negative index counts from the end of the list, where -1 is the last element.
+// ErrIndexOutOfRange is returned if there is no element at the index.
+func (l *List) SetAt(index int, value string) error {
+	if !l.host.rawUTF8 {
+		Encode(&value)
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s = $1 WHERE id = %s", l.table, listCol, l.idAt(index))
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := l.host.db.Exec(query, value)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIndexOutOfRange
+	}
+	return nil
+}
+
+// Range returns the elements from start to stop, including both, like LRANGE in Redis.
+// Negative indices count from the end of the list, where -1 is the last element.
+// Indices that are out of range are not an error, only the elements that exist are returned.
+func (l *List) Range(start, stop int) ([]string, error) {
+	if start < 0 || stop < 0 {
+		n, err := l.Count()
+		if err != nil {
+			return []string{}, err
+		}
+		if start < 0 {
+			start += n
+			if start < 0 {
+				start = 0
+			}
+		}
+		if stop < 0 {
+			stop += n
+		}
+	}
+	if stop < start {
+		return []string{}, nil
+	}
+	return l.values(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT $1 OFFSET $2", listCol, l.table, listOrder()), stop-start+1, start)
+}
+
+// InsertBefore inserts a value right before the first occurrence of pivot, like LINSERT BEFORE in Redis.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (l *List) InsertBefore(pivot, value string) error {
+	return l.insertNextTo(pivot, value, false)
+}
+
+// InsertAfter inserts a value right after the first occurrence of pivot, like LINSERT AFTER in Redis.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (l *List) InsertAfter(pivot, value string) error {
+	return l.insertNextTo(pivot, value, true)
+}
+
+// insertNextTo inserts a value right before or after the first occurrence of pivot.
+// The new position is halfway between the pivot and its neighbour. The positions are
+// only renumbered if there is no room left between the two.
+func (l *List) insertNextTo(pivot, value string, after bool) error {
+	ctx := context.Background()
+	return l.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		return l.insertNextToWithTransaction(ctx, transaction, pivot, value, after)
+	})
+}
+
+// insertNextToWithTransaction inserts a value right before or after the first occurrence of pivot, as part of a transaction
+func (l *List) insertNextToWithTransaction(ctx context.Context, transaction *sql.Tx, pivot, value string, after bool) error {
+	originalPivot := pivot
+	if !l.host.rawUTF8 {
+		Encode(&pivot)
+		Encode(&value)
+	}
+	if err := lockWithTransaction(ctx, transaction, l.table); err != nil {
+		return err
+	}
+	var (
+		id  int64
+		pos float64
+	)
+	query := fmt.Sprintf("SELECT id, %s FROM %s WHERE %s = $1 ORDER BY %s LIMIT 1", positionColumn(), l.table, listCol, listOrder())
+	if Verbose {
+		fmt.Println(query)
+	}
+	if err := transaction.QueryRowContext(ctx, query, pivot).Scan(&id, &pos); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrValueNotFound, originalPivot)
+		}
+		return err
+	}
+	neighbourQuery := fmt.Sprintf("SELECT %s FROM %s WHERE (%s, id) < ($1, $2) ORDER BY %s LIMIT 1", positionColumn(), l.table, positionColumn(), listOrderDesc())
+	if after {
+		neighbourQuery = fmt.Sprintf("SELECT %s FROM %s WHERE (%s, id) > ($1, $2) ORDER BY %s LIMIT 1", positionColumn(), l.table, positionColumn(), listOrder())
+	}
+	var newPos float64
+	for renumbered := false; ; renumbered = true {
+		if Verbose {
+			fmt.Println(neighbourQuery)
+		}
+		var neighbourPos float64
+		err := transaction.QueryRowContext(ctx, neighbourQuery, pos, id).Scan(&neighbourPos)
+		if err == sql.ErrNoRows {
+			// Inserting at the start or at the end of the list
+			newPos = pos - 1
+			if after {
+				newPos = pos + 1
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		newPos = pos + (neighbourPos-pos)/2
+		if (newPos != pos && newPos != neighbourPos) || renumbered {
+			break
+		}
+		// No room left between the two positions, renumber all elements and try again
+		query = fmt.Sprintf("UPDATE %s SET %s = r.n FROM (SELECT id, row_number() OVER (ORDER BY %s) AS n FROM %s) r WHERE %s.id = r.id", l.table, positionColumn(), listOrder(), l.table, l.table)
+		if _, err := execWithTransaction(ctx, transaction, query); err != nil {
+			return err
+		}
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE id = $1", positionColumn(), l.table)
+		if err := transaction.QueryRowContext(ctx, query, id).Scan(&pos); err != nil {
+			return err
+		}
+	}
+	_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("WITH i AS (INSERT INTO %s (%s, %s) VALUES ($1, $2) RETURNING id) SELECT pg_notify($3, '') FROM i", l.table, listCol, positionColumn()), value, newPos, notifyChannel(l.table))
+	return err
+}
+
+// PushFront adds an element to the start of the list, like LPUSH in Redis
+func (l *List) PushFront(value string) error {
+	ctx := context.Background()
+	return l.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		return l.pushFrontWithTransaction(ctx, transaction, value)
+	})
+}
+
+// pushFrontWithTransaction adds an element to the start of the list, as part of a transaction
+func (l *List) pushFrontWithTransaction(ctx context.Context, transaction *sql.Tx, value string) error {
+	if !l.host.rawUTF8 {
+		Encode(&value)
+	}
+	// Serialize PushFront calls for this list, so that two elements never get the same position
+	if _, err := execWithTransaction(ctx, transaction, "SELECT pg_advisory_xact_lock(hashtext($1))", l.table); err != nil {
+		return err
+	}
+	_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("WITH i AS (INSERT INTO %s (%s, %s) SELECT $1, COALESCE(MIN(%s), 1) - 1 FROM %s RETURNING id) SELECT pg_notify($2, '') FROM i", l.table, listCol, positionColumn(), positionColumn(), l.table), value, notifyChannel(l.table))
+	return err
+}
+
+// pop removes and returns up to n elements, in the given order.
+// Elements that are locked by other transactions are skipped, so that several consumers can pop from the same list.
+func (l *List) pop(n int, order string) ([]string, error) {
+	return l.values(fmt.Sprintf("WITH d AS (DELETE FROM %s WHERE id IN (SELECT id FROM %s ORDER BY %s LIMIT $1 FOR UPDATE SKIP LOCKED) RETURNING %s, %s, id) SELECT %s FROM d ORDER BY %s", l.table, l.table, order, listCol, positionColumn(), listCol, order), n)
+}
+
+// PopFront removes and returns the first element of the list, like LPOP in Redis.
+// ErrNoAvailableValues is returned if the list is empty.
+func (l *List) PopFront() (string, error) {
+	values, err := l.pop(1, listOrder())
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrNoAvailableValues
+	}
+	return values[0], nil
+}
+
+// PopBack removes and returns the last element of the list, like RPOP in Redis.
+// ErrNoAvailableValues is returned if the list is empty.
+func (l *List) PopBack() (string, error) {
+	values, err := l.pop(1, listOrderDesc())
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrNoAvailableValues
+	}
+	return values[0], nil
+}
+
+// PopN removes and returns the n first elements of the list, like LPOP with a count in Redis.
+// If the list has fewer than n elements, all of them are returned.
+func (l *List) PopN(n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	return l.pop(n, listOrder())
+}
+
+// BlockingPopFront removes and returns the first element of the list, like BLPOP in Redis.
+// If the list is empty, it waits until an element is added, the timeout has passed or the context is done.
+// A timeout of 0 means waiting until the context is done, like BLPOP with a timeout of 0, and a negative timeout
+// means not waiting. ErrNoAvailableValues is returned if the timeout passes.
+// Waiting consumers are woken up by notifications from Add, PushFront, InsertBefore and InsertAfter,
+// and check the list now and then in case notifications are lost.
+func (l *List) BlockingPopFront(ctx context.Context, timeout time.Duration) (string, error) {
+	if timeout < 0 {
+		return l.PopFront()
+	}
+	channel := notifyChannel(l.table)
+	// Subscribe before checking the list, so that no notification is missed
+	wake, unsubscribe := l.host.subscribe(channel)
+	defer unsubscribe()
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		value, err := l.PopFront()
+		if err != ErrNoAvailableValues {
+			return value, err
+		}
+		poll := time.NewTimer(l.host.pollInterval(channel))
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-deadline:
+			poll.Stop()
+			return "", ErrNoAvailableValues
+		case <-ctx.Done():
+			poll.Stop()
+			return "", ctx.Err()
+		}
+		poll.Stop()
+	}
+}
+
+// indexOf returns the index of the first element with the given value, when the list is sorted with the given order.
+// The index always counts from the start of the list. -1 is returned if the value is not in the list.
+func (l *List) indexOf(value, order string) (int, error) {
+	if !l.host.rawUTF8 {
+		Encode(&value)
+	}
+	query := fmt.Sprintf("WITH f AS (SELECT %s AS p, id FROM %s WHERE %s = $1 ORDER BY %s LIMIT 1) SELECT (SELECT COUNT(*) FROM %s WHERE (%s, id) < (f.p, f.id)) FROM f", positionColumn(), l.table, listCol, order, l.table, positionColumn())
+	if Verbose {
+		fmt.Println(query)
+	}
+	var index int
+	if err := l.host.db.QueryRow(query, value).Scan(&index); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, nil
+		}
+		return -1, err
+	}
+	return index, nil
+}
+
+// IndexOf returns the index of the first occurrence of the given value, or -1 if the value is not in the list
+func (l *List) IndexOf(value string) (int, error) {
+	return l.indexOf(value, listOrder())
+}
+
+// LastIndexOf returns the index of the last occurrence of the given value, or -1 if the value is not in the list.
+// The index counts from the start of the list.
+func (l *List) LastIndexOf(value string) (int, error) {
+	return l.indexOf(value, listOrderDesc())
+}
+
+// CountValue counts how many times the given value is in the list
+func (l *List) CountValue(value string) (int64, error) {
+	if !l.host.rawUTF8 {
+		Encode(&value)
+	}
+	var count int64
+	err := l.host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = $1", l.table, listCol), value).Scan(&count)
+	return count, err
+}
+
+// RemoveValue removes elements with the given value, like LREM in Redis.
+// If count > 0, the first count occurrences are removed. If count < 0, the last -count
+// occurrences are removed. If count == 0, all occurrences are removed.
+// Returns the number of removed elements.
+func (l *List) RemoveValue(value string, count int) (int64, error) {
+	if !l.host.rawUTF8 {
+		Encode(&value)
+	}
+	var query string
+	switch {
+	case count > 0:
+		query = fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s = $1 ORDER BY %s LIMIT %d)", l.table, l.table, listCol, listOrder(), count)
+	case count < 0:
+		query = fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s = $1 ORDER BY %s LIMIT %d)", l.table, l.table, listCol, listOrderDesc(), -count)
+	default:
+		query = fmt.Sprintf("DELETE FROM %s WHERE %s = $1", l.table, listCol)
+	}
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := l.host.db.Exec(query, value)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Trim removes all elements that are not between start and stop, including both, like LTRIM in Redis.
+// Negative indices count from the end of the list, where -1 is the last element.
+func (l *List) Trim(start, stop int) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM (SELECT id, row_number() OVER (ORDER BY %s) - 1 AS i, COUNT(*) OVER () AS n FROM %s) AS temp WHERE i < (CASE WHEN $1 < 0 THEN n + $1 ELSE $1 END) OR i > (CASE WHEN $2 < 0 THEN n + $2 ELSE $2 END))", l.table, listOrder(), l.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := l.host.db.Exec(query, start, stop)
+	return err
+}
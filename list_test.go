@@ -1,7 +1,13 @@
 package simplehstore
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/xyproto/pinterface"
 )
@@ -140,3 +146,371 @@ func TestRemoveItemFromList(t *testing.T) {
 		t.Errorf("Error, could not remove list! %s", err)
 	}
 }
+
+func TestListIndex(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	for _, value := range []string{"a", "b", "c", "d"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if value, err := list.Get(0); err != nil || value != "a" {
+		t.Errorf("Error, expected a, got %s (%v)", value, err)
+	}
+	if value, err := list.Get(-1); err != nil || value != "d" {
+		t.Errorf("Error, expected d, got %s (%v)", value, err)
+	}
+	if _, err := list.Get(4); err != ErrIndexOutOfRange {
+		t.Errorf("Error, expected ErrIndexOutOfRange, got: %v", err)
+	}
+	if err := list.SetAt(-2, "C"); err != nil {
+		t.Error(err)
+	}
+	if err := list.SetAt(-5, "x"); err != ErrIndexOutOfRange {
+		t.Errorf("Error, expected ErrIndexOutOfRange, got: %v", err)
+	}
+
+	for _, tc := range []struct {
+		start, stop int
+		expected    string
+	}{
+		{0, -1, "abCd"},
+		{1, 2, "bC"},
+		{-2, -1, "Cd"},
+		{-100, 100, "abCd"},
+		{3, 1, ""},
+	} {
+		values, err := list.Range(tc.start, tc.stop)
+		if err != nil {
+			t.Error(err)
+		}
+		if strings.Join(values, "") != tc.expected {
+			t.Errorf("Error, Range(%d, %d) should be %s, got %v", tc.start, tc.stop, tc.expected, values)
+		}
+	}
+
+	if err := list.InsertBefore("a", "first"); err != nil {
+		t.Error(err)
+	}
+	if err := list.InsertAfter("d", "last"); err != nil {
+		t.Error(err)
+	}
+	// Insert many times at the same spot, so that the positions must be renumbered
+	for i := 0; i < 60; i++ {
+		if err := list.InsertAfter("a", "x"); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := list.InsertBefore("missing", "x"); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("Error, expected ErrValueNotFound, got: %v", err)
+	}
+	values, err := list.All()
+	if err != nil {
+		t.Error(err)
+	}
+	expected := "first a " + strings.Repeat("x ", 60) + "b C d last"
+	if strings.Join(values, " ") != expected {
+		t.Errorf("Error, wrong list contents: %v", values)
+	}
+	if last, err := list.Last(); err != nil || last != "last" {
+		t.Errorf("Error, expected last, got %s (%v)", last, err)
+	}
+}
+
+func TestListPop(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	if _, err := list.PopFront(); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues, got: %v", err)
+	}
+	for _, value := range []string{"b", "c", "d"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := list.PushFront("a"); err != nil {
+		t.Error(err)
+	}
+	if err := list.PushFront("0"); err != nil {
+		t.Error(err)
+	}
+	if value, err := list.PopFront(); err != nil || value != "0" {
+		t.Errorf("Error, expected 0, got %s (%v)", value, err)
+	}
+	if value, err := list.PopBack(); err != nil || value != "d" {
+		t.Errorf("Error, expected d, got %s (%v)", value, err)
+	}
+	values, err := list.PopN(5)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, "") != "abc" {
+		t.Errorf("Error, expected abc, got %v", values)
+	}
+
+	// Drain a list with several consumers, and check that every element is popped exactly once
+	const count = 200
+	for i := 0; i < count; i++ {
+		if err := list.Add(strconv.Itoa(i)); err != nil {
+			t.Error(err)
+		}
+	}
+	var (
+		mut    sync.Mutex
+		wg     sync.WaitGroup
+		popped = make(map[string]int)
+	)
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				value, err := list.PopFront()
+				if err == ErrNoAvailableValues {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mut.Lock()
+				popped[value]++
+				mut.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(popped) != count {
+		t.Errorf("Error, expected %d popped elements, got %d", count, len(popped))
+	}
+	for value, n := range popped {
+		if n != 1 {
+			t.Errorf("Error, %s was popped %d times", value, n)
+		}
+	}
+}
+
+func TestListBlockingPopFront(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	ctx := context.Background()
+	start := time.Now()
+	if _, err := list.BlockingPopFront(ctx, 200*time.Millisecond); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues after the timeout, got: %v", err)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Error("Error, BlockingPopFront returned before the timeout")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := list.BlockingPopFront(cancelled, 0); err != context.Canceled {
+		t.Errorf("Error, expected context.Canceled, got: %v", err)
+	}
+	if _, err := list.BlockingPopFront(ctx, -1); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues without waiting, got: %v", err)
+	}
+
+	// Several consumers wait for elements that are added later
+	const consumers, count = 4, 40
+	var (
+		mut      sync.Mutex
+		wg       sync.WaitGroup
+		received = make(map[string]int)
+	)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				value, err := list.BlockingPopFront(ctx, 2*time.Second)
+				if err == ErrNoAvailableValues {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mut.Lock()
+				received[value]++
+				mut.Unlock()
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < count; i++ {
+		if err := list.Add(strconv.Itoa(i)); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Wait()
+	if len(received) != count {
+		t.Errorf("Error, expected %d received elements, got %d", count, len(received))
+	}
+	for value, n := range received {
+		if n != 1 {
+			t.Errorf("Error, %s was received %d times", value, n)
+		}
+	}
+}
+
+func TestListBlockingPopFrontPolling(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	// Without a connection string, there is no listener, and the consumers must poll
+	host.connectionString = ""
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		if err := list.Add("late"); err != nil {
+			t.Error(err)
+		}
+	}()
+	if value, err := list.BlockingPopFront(context.Background(), 5*time.Second); err != nil || value != "late" {
+		t.Errorf("Error, expected late, got %s (%v)", value, err)
+	}
+}
+
+func TestListValues(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	for _, value := range []string{"a", "b", "a", "c", "a", "b"} {
+		if err := list.Add(value); err != nil {
+			t.Error(err)
+		}
+	}
+	if count, err := list.Count(); err != nil || count != 6 {
+		t.Errorf("Error, expected 6 elements, got %d (%v)", count, err)
+	}
+	if count, err := list.CountInt64(); err != nil || count != 6 {
+		t.Errorf("Error, expected 6 elements, got %d (%v)", count, err)
+	}
+	if has, err := list.Has("c"); err != nil || !has {
+		t.Errorf("Error, the list should have c (%v)", err)
+	}
+	if has, err := list.Has("1"); err != nil || has {
+		t.Errorf("Error, the list should not have 1, which is an id and not a value (%v)", err)
+	}
+	if count, err := list.CountValue("a"); err != nil || count != 3 {
+		t.Errorf("Error, expected 3 a's, got %d (%v)", count, err)
+	}
+	if index, err := list.IndexOf("b"); err != nil || index != 1 {
+		t.Errorf("Error, expected the first b at 1, got %d (%v)", index, err)
+	}
+	if index, err := list.LastIndexOf("b"); err != nil || index != 5 {
+		t.Errorf("Error, expected the last b at 5, got %d (%v)", index, err)
+	}
+	if index, err := list.IndexOf("x"); err != nil || index != -1 {
+		t.Errorf("Error, expected -1 for a missing value, got %d (%v)", index, err)
+	}
+
+	if n, err := list.RemoveValue("a", -1); err != nil || n != 1 {
+		t.Errorf("Error, expected 1 removed element, got %d (%v)", n, err)
+	}
+	if values, err := list.All(); err != nil || strings.Join(values, "") != "abacb" {
+		t.Errorf("Error, expected abacb, got %v (%v)", values, err)
+	}
+	if n, err := list.RemoveValue("b", 1); err != nil || n != 1 {
+		t.Errorf("Error, expected 1 removed element, got %d (%v)", n, err)
+	}
+	if values, err := list.All(); err != nil || strings.Join(values, "") != "aacb" {
+		t.Errorf("Error, expected aacb, got %v (%v)", values, err)
+	}
+	if n, err := list.RemoveValue("a", 0); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 removed elements, got %d (%v)", n, err)
+	}
+	if values, err := list.All(); err != nil || strings.Join(values, "") != "cb" {
+		t.Errorf("Error, expected cb, got %v (%v)", values, err)
+	}
+}
+
+func TestListTrim(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer list.Remove()
+
+	for _, tc := range []struct {
+		start, stop int
+		expected    string
+	}{
+		{1, -2, "bcd"},
+		{0, 1, "ab"},
+		{-2, -1, "de"},
+		{-100, 100, "abcde"},
+		{3, 1, ""},
+		{5, 10, ""},
+	} {
+		list.Clear()
+		for _, value := range []string{"a", "b", "c", "d", "e"} {
+			if err := list.Add(value); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := list.Trim(tc.start, tc.stop); err != nil {
+			t.Error(err)
+		}
+		values, err := list.All()
+		if err != nil {
+			t.Error(err)
+		}
+		if strings.Join(values, "") != tc.expected {
+			t.Errorf("Error, Trim(%d, %d) should leave %s, got %v", tc.start, tc.stop, tc.expected, values)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package simplehstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// How often waiting consumers check for new elements if notifications can not be received
+	notifyPollInterval = 100 * time.Millisecond
+	// How often waiting consumers check for new elements, even if notifications can be received
+	notifySafetyInterval = 5 * time.Second
+)
+
+// notifier wakes up consumers that are waiting for new elements, by using LISTEN and NOTIFY.
+// A single pq.Listener connection is shared by all waiting consumers for a Host.
+// If the listener connection is lost, the consumers fall back to polling.
+type notifier struct {
+	mut       sync.Mutex
+	listener  *pq.Listener
+	connected bool
+	listening map[string]bool                       // channels that the listener has started listening to, and if it is done
+	waiters   map[string]map[chan struct{}]struct{} // waiting consumers, per channel
+}
+
+// notifyChannel returns a deterministic NOTIFY channel name for the given quoted table name
+func notifyChannel(table string) string {
+	return objectName(table, "notify")
+}
+
+// subscribe registers a consumer that waits for notifications on the given channel.
+// The returned channel receives a value when there may be something new,
+// and the returned function must be called when the consumer is done waiting.
+func (host *Host) subscribe(channel string) (<-chan struct{}, func()) {
+	n := &host.notifier
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	if n.waiters == nil {
+		n.waiters = make(map[string]map[chan struct{}]struct{})
+		n.listening = make(map[string]bool)
+	}
+	wake := make(chan struct{}, 1)
+	if n.waiters[channel] == nil {
+		n.waiters[channel] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[channel][wake] = struct{}{}
+	if n.listener == nil && host.connectionString != "" {
+		n.listener = pq.NewListener(host.connectionString, 10*time.Millisecond, time.Minute, host.listenerEvent)
+		go host.dispatchNotifications(n.listener)
+	}
+	if _, started := n.listening[channel]; n.listener != nil && !started {
+		// Listen blocks until the listener is connected, so it is called in the background.
+		// Once listening, the channel is kept open for the lifetime of the listener.
+		n.listening[channel] = false
+		go func(listener *pq.Listener) {
+			if err := listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+				return
+			}
+			n.mut.Lock()
+			defer n.mut.Unlock()
+			if n.listener != listener {
+				// Stopped in the meantime
+				return
+			}
+			n.listening[channel] = true
+			// Anything that happened before listening was missed
+			n.wake(channel)
+		}(n.listener)
+	}
+	return wake, func() {
+		n.mut.Lock()
+		defer n.mut.Unlock()
+		delete(n.waiters[channel], wake)
+	}
+}
+
+// pollInterval returns how often consumers that wait for the given channel should check for new elements
+func (host *Host) pollInterval(channel string) time.Duration {
+	n := &host.notifier
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	if n.connected && n.listening[channel] {
+		return notifySafetyInterval
+	}
+	return notifyPollInterval
+}
+
+// wake wakes up all consumers that wait for the given channel.
+// Must be called with the mutex locked.
+func (n *notifier) wake(channel string) {
+	for wake := range n.waiters[channel] {
+		select {
+		case wake <- struct{}{}:
+		default:
+			// Already woken up
+		}
+	}
+}
+
+// wakeAll wakes up all waiting consumers. Must be called with the mutex locked.
+func (n *notifier) wakeAll() {
+	for channel := range n.waiters {
+		n.wake(channel)
+	}
+}
+
+// listenerEvent keeps track of the state of the listener connection
+func (host *Host) listenerEvent(event pq.ListenerEventType, err error) {
+	n := &host.notifier
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		n.connected = true
+		// Notifications may have been missed while disconnected
+		n.wakeAll()
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		n.connected = false
+	}
+}
+
+// dispatchNotifications wakes up the consumers that wait for a channel when there is a notification,
+// until the listener is closed
+func (host *Host) dispatchNotifications(listener *pq.Listener) {
+	n := &host.notifier
+	for notification := range listener.Notify {
+		n.mut.Lock()
+		if notification == nil {
+			// The connection was re-established, and notifications may have been missed
+			n.wakeAll()
+		} else {
+			n.wake(notification.Channel)
+		}
+		n.mut.Unlock()
+	}
+}
+
+// stopListener closes the listener connection, if there is one
+func (host *Host) stopListener() {
+	n := &host.notifier
+	n.mut.Lock()
+	listener := n.listener
+	n.listener = nil
+	n.connected = false
+	n.listening = make(map[string]bool)
+	n.wakeAll()
+	n.mut.Unlock()
+	// The listener may call listenerEvent while closing, so the mutex must not be locked here
+	if listener != nil {
+		listener.Close()
+	}
+}
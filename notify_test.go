@@ -0,0 +1,22 @@
+package simplehstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotifyChannel(t *testing.T) {
+	a := notifyChannel(`"jobs"`)
+	if a != notifyChannel(`"jobs"`) {
+		t.Error("Error, channel names should be deterministic")
+	}
+	if a == notifyChannel(`"other_jobs"`) {
+		t.Error("Error, channel names should differ for different tables")
+	}
+	if strings.Contains(a, `"`) {
+		t.Errorf("Error, the channel name should not be quoted: %s", a)
+	}
+	if long := notifyChannel(`"` + strings.Repeat("x", 80) + `"`); len(long) > 63 {
+		t.Errorf("Error, the channel name is too long: %s", long)
+	}
+}
@@ -0,0 +1,270 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PartitionInterval is the time range that each partition of a PartitionedList covers
+type PartitionInterval int
+
+const (
+	// PartitionDaily gives one partition per day
+	PartitionDaily PartitionInterval = iota
+	// PartitionWeekly gives one partition per week, starting on Mondays
+	PartitionWeekly
+	// PartitionMonthly gives one partition per month
+	PartitionMonthly
+)
+
+// How many partitions after the current one that are created in advance
+const partitionsAhead = 2
+
+// ErrNotPartitioned is returned when a PartitionedList is created for an existing table that is not partitioned
+var ErrNotPartitioned = errors.New("table exists, but is not partitioned")
+
+// start returns the start of the partition that contains t, in UTC
+func (interval PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch interval {
+	case PartitionWeekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case PartitionMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next returns the start of the partition after the one that starts at the given time
+func (interval PartitionInterval) next(start time.Time) time.Time {
+	switch interval {
+	case PartitionWeekly:
+		return start.AddDate(0, 0, 7)
+	case PartitionMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// PartitionedList is a TimestampedList that is stored in a table that is partitioned by the time
+// the elements were added. Old elements can be removed cheaply by dropping whole partitions.
+// Partitions are created when needed by the methods that add elements, and a few partitions ahead are created in advance.
+type PartitionedList struct {
+	*TimestampedList
+	interval PartitionInterval
+	mut      sync.Mutex
+	created  map[time.Time]bool // partitions that are known to exist, by start time
+}
+
+// NewPartitionedList creates a new list that is partitioned by time, with one partition per day, week or month.
+// Tables that already exist and are not partitioned can not be upgraded, and give an error that wraps ErrNotPartitioned.
+func NewPartitionedList(host *Host, name string, interval PartitionInterval) (*PartitionedList, error) {
+	table := pq.QuoteIdentifier(name)
+	if err := createPartitionedTable(host, table); err != nil {
+		return nil, err
+	}
+	tl, err := NewTimestampedList(host, name)
+	if err != nil {
+		return nil, err
+	}
+	pl := &PartitionedList{TimestampedList: tl, interval: interval, created: make(map[time.Time]bool)}
+	if err := pl.CreatePartitionsAhead(partitionsAhead); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
+
+// createPartitionedTable creates the partitioned parent table, if it is missing.
+// The position column is added by NewList, like for regular lists.
+func createPartitionedTable(host *Host, table string) error {
+	var kind sql.NullString
+	if err := host.db.QueryRow("SELECT relkind::text FROM pg_class WHERE oid = to_regclass($1)", table).Scan(&kind); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if kind.Valid {
+		if kind.String != "p" {
+			return fmt.Errorf("%w: %s", ErrNotPartitioned, table)
+		}
+		return nil
+	}
+	ctx := context.Background()
+	return host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		for _, query := range []string{
+			fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id SERIAL, %s %s, %s TIMESTAMPTZ NOT NULL DEFAULT now(), PRIMARY KEY (id, %s)) PARTITION BY RANGE (%s)", table, listCol, defaultStringType, pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol)),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName(table, createdAtCol), table, pq.QuoteIdentifier(createdAtCol)),
+		} {
+			if _, err := execWithTransaction(ctx, transaction, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Interval returns the time range that each partition covers
+func (pl *PartitionedList) Interval() PartitionInterval {
+	return pl.interval
+}
+
+// partitionName returns the quoted name of the partition that starts at the given time
+func (pl *PartitionedList) partitionName(start time.Time) string {
+	return pq.QuoteIdentifier(objectName(pl.table, "part", start.Format("20060102")))
+}
+
+// ensurePartition creates the partition that contains t, if it does not already exist
+func (pl *PartitionedList) ensurePartition(t time.Time) error {
+	start := pl.interval.start(t)
+	pl.mut.Lock()
+	defer pl.mut.Unlock()
+	if pl.created[start] {
+		return nil
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')", pl.partitionName(start), pl.table, start.Format(time.RFC3339), pl.interval.next(start).Format(time.RFC3339))
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := pl.host.db.Exec(query); err != nil && !strings.HasSuffix(err.Error(), "already exists") {
+		return err
+	}
+	pl.created[start] = true
+	return nil
+}
+
+// CreatePartitionsAhead makes sure that there are partitions for the current time range and the n following ones
+func (pl *PartitionedList) CreatePartitionsAhead(n int) error {
+	start := pl.interval.start(time.Now())
+	for i := 0; i <= n; i++ {
+		if err := pl.ensurePartition(start); err != nil {
+			return err
+		}
+		start = pl.interval.next(start)
+	}
+	return nil
+}
+
+// Add an element to the end of the list, creating partitions if needed.
+// Consumers that wait in BlockingPopFront are notified.
+func (pl *PartitionedList) Add(value string) error {
+	return pl.AddAt(value, time.Now())
+}
+
+// AddAt adds an element to the end of the list, with the given time instead of the current time.
+// The partition for the given time is created if needed. Consumers that wait in BlockingPopFront are notified.
+func (pl *PartitionedList) AddAt(value string, t time.Time) error {
+	return pl.withPartition(t, func() error {
+		return pl.TimestampedList.AddAt(value, t)
+	})
+}
+
+// PushFront adds an element to the start of the list, like LPUSH in Redis, creating partitions if needed
+func (pl *PartitionedList) PushFront(value string) error {
+	return pl.withPartition(time.Now(), func() error {
+		return pl.TimestampedList.PushFront(value)
+	})
+}
+
+// InsertBefore inserts a value right before the first occurrence of pivot, creating partitions if needed.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (pl *PartitionedList) InsertBefore(pivot, value string) error {
+	return pl.withPartition(time.Now(), func() error {
+		return pl.TimestampedList.InsertBefore(pivot, value)
+	})
+}
+
+// InsertAfter inserts a value right after the first occurrence of pivot, creating partitions if needed.
+// An error that wraps ErrValueNotFound is returned if pivot is not in the list.
+func (pl *PartitionedList) InsertAfter(pivot, value string) error {
+	return pl.withPartition(time.Now(), func() error {
+		return pl.TimestampedList.InsertAfter(pivot, value)
+	})
+}
+
+// withPartition makes sure that the partition for the given time and the partitions ahead exist, and calls insert.
+// If the partition has been dropped by someone else in the meantime, it is created again and insert is called once more.
+func (pl *PartitionedList) withPartition(t time.Time, insert func() error) error {
+	if err := pl.CreatePartitionsAhead(partitionsAhead); err != nil {
+		return err
+	}
+	if err := pl.ensurePartition(t); err != nil {
+		return err
+	}
+	err := insert()
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23514" {
+		pl.mut.Lock()
+		delete(pl.created, pl.interval.start(t))
+		pl.mut.Unlock()
+		if err := pl.ensurePartition(t); err != nil {
+			return err
+		}
+		return insert()
+	}
+	return err
+}
+
+// partitions returns the quoted names of the partitions that only contain elements added before the given time,
+// or all partitions if all is true
+func (pl *PartitionedList) partitions(t time.Time, all bool) ([]string, error) {
+	// The upper bound of each partition is found in the partition bound expression
+	query := "SELECT c.oid::regclass::text FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = to_regclass($1) AND ($3 OR (regexp_match(pg_get_expr(c.relpartbound, c.oid), 'TO \\(''([^'']+)''\\)'))[1]::timestamptz <= $2) ORDER BY 1"
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := pl.host.db.Query(query, pl.table, t, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Partitions returns the names of all partitions of the list, sorted by name
+func (pl *PartitionedList) Partitions() ([]string, error) {
+	return pl.partitions(time.Time{}, true)
+}
+
+// DropPartitionsOlderThan removes all partitions that only contain elements that were added before the given time.
+// This is much faster than DeleteOlderThan for large lists, but elements in the partition that contains
+// the given time are kept. Returns the number of dropped partitions.
+func (pl *PartitionedList) DropPartitionsOlderThan(t time.Time) (int, error) {
+	names, err := pl.partitions(t, false)
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		query := fmt.Sprintf("DROP TABLE IF EXISTS %s", name)
+		if Verbose {
+			fmt.Println(query)
+		}
+		if _, err := pl.host.db.Exec(query); err != nil {
+			return i, err
+		}
+	}
+	// Forget about the dropped partitions, so that they are created again if elements are added to them
+	pl.mut.Lock()
+	for start := range pl.created {
+		if !pl.interval.next(start).After(t) {
+			delete(pl.created, start)
+		}
+	}
+	pl.mut.Unlock()
+	return len(names), nil
+}
@@ -0,0 +1,143 @@
+package simplehstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/pinterface"
+)
+
+func TestPartitionInterval(t *testing.T) {
+	// A Wednesday
+	at := time.Date(2024, time.February, 28, 15, 4, 5, 0, time.UTC)
+	for interval, expected := range map[PartitionInterval][2]string{
+		PartitionDaily:   {"2024-02-28", "2024-02-29"},
+		PartitionWeekly:  {"2024-02-26", "2024-03-04"},
+		PartitionMonthly: {"2024-02-01", "2024-03-01"},
+	} {
+		start := interval.start(at)
+		if start.Format("2006-01-02") != expected[0] {
+			t.Errorf("Error, expected %s to start at %s, got %s", at, expected[0], start)
+		}
+		if next := interval.next(start); next.Format("2006-01-02") != expected[1] {
+			t.Errorf("Error, expected the next partition to start at %s, got %s", expected[1], next)
+		}
+	}
+	// Sundays belong to the week that started on the Monday before
+	if start := PartitionWeekly.start(time.Date(2024, time.March, 3, 23, 0, 0, 0, time.UTC)); start.Format("2006-01-02") != "2024-02-26" {
+		t.Errorf("Error, unexpected start of week: %s", start)
+	}
+}
+
+func TestPartitionedList(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	// Regular list tables can not be used
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := NewPartitionedList(host, listname, PartitionDaily); !errors.Is(err, ErrNotPartitioned) {
+		t.Errorf("Error, expected ErrNotPartitioned, got: %v", err)
+	}
+	list.Remove()
+
+	events, err := NewPartitionedList(host, listname, PartitionDaily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Remove()
+
+	// Check that the partitioned list qualifies for the IList interface
+	var _ pinterface.IList = events
+
+	partitions, err := events.Partitions()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(partitions) != partitionsAhead+1 {
+		t.Errorf("Error, expected %d partitions, got %v", partitionsAhead+1, partitions)
+	}
+
+	now := time.Now()
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	if err := events.AddAt("a week ago", weekAgo); err != nil {
+		t.Error(err)
+	}
+	if err := events.Add("now"); err != nil {
+		t.Error(err)
+	}
+	if err := events.PushFront("first"); err != nil {
+		t.Error(err)
+	}
+	values, err := events.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "first,a week ago,now" {
+		t.Errorf("Error, unexpected elements: %v", values)
+	}
+	if last, err := events.Last(); err != nil || last != "now" {
+		t.Errorf("Error, expected now, got %s (%v)", last, err)
+	}
+
+	// Only the partition from a week ago is old enough to be dropped
+	dropped, err := events.DropPartitionsOlderThan(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Error(err)
+	}
+	if dropped != 1 {
+		t.Errorf("Error, expected 1 dropped partition, got %d", dropped)
+	}
+	values, err = events.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "first,now" {
+		t.Errorf("Error, unexpected elements after dropping partitions: %v", values)
+	}
+	// The dropped partition is created again when needed
+	if err := events.AddAt("a week ago again", weekAgo); err != nil {
+		t.Error(err)
+	}
+	if count, err := events.Count(); err != nil || count != 3 {
+		t.Errorf("Error, expected 3 elements, got %d (%v)", count, err)
+	}
+
+	// Partitions that are dropped by someone else are created again by PushFront, InsertBefore and InsertAfter
+	other, err := NewPartitionedList(host, listname, PartitionDaily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.DropPartitionsOlderThan(now.AddDate(0, 0, 10)); err != nil {
+		t.Error(err)
+	}
+	if err := events.PushFront("pushed"); err != nil {
+		t.Error(err)
+	}
+	if err := events.InsertBefore("pushed", "before"); err != nil {
+		t.Error(err)
+	}
+	if err := events.InsertAfter("pushed", "after"); err != nil {
+		t.Error(err)
+	}
+	values, err = events.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "before,pushed,after" {
+		t.Errorf("Error, unexpected elements after recreating the partitions: %v", values)
+	}
+
+	if err := events.Clear(); err != nil {
+		t.Error(err)
+	}
+	if count, err := events.Count(); err != nil || count != 0 {
+		t.Errorf("Error, expected an empty list, got %d elements (%v)", count, err)
+	}
+}
@@ -0,0 +1,139 @@
+package simplehstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// HashMapQuery finds owners in a HashMap by combining several conditions.
+// Create one with HashMap.Query. The conditions use the hstore operators
+// @>, ? and ?|, which can use the GIN index created by CreateIndexTable.
+type HashMapQuery struct {
+	h          *HashMap
+	conditions []string
+	args       []interface{}
+	limit      int
+	offset     int
+}
+
+// Query returns a new HashMapQuery, for finding owners that match several conditions
+func (h *HashMap) Query() *HashMapQuery {
+	return &HashMapQuery{h: h}
+}
+
+// arg adds an argument to the query and returns the placeholder for it
+func (q *HashMapQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// owns adds a condition that an owner must (or must not) have a row where the given hstore condition is true
+func (q *HashMapQuery) owns(condition string, not bool) *HashMapQuery {
+	c := fmt.Sprintf("EXISTS (SELECT 1 FROM %s c WHERE c.%s = o.%s AND c.%s)", q.h.table, ownerCol, ownerCol, condition)
+	if not {
+		c = "NOT " + c
+	}
+	q.conditions = append(q.conditions, c)
+	return q
+}
+
+// Where only matches owners where key == value
+func (q *HashMapQuery) Where(key, value string) *HashMapQuery {
+	if !q.h.host.rawUTF8 {
+		Encode(&value)
+	}
+	return q.owns(fmt.Sprintf("attr @> hstore(%s::text, %s::text)", q.arg(key), q.arg(value)), false)
+}
+
+// WhereNot only matches owners where key != value, including owners that do not have the key
+func (q *HashMapQuery) WhereNot(key, value string) *HashMapQuery {
+	if !q.h.host.rawUTF8 {
+		Encode(&value)
+	}
+	return q.owns(fmt.Sprintf("attr @> hstore(%s::text, %s::text)", q.arg(key), q.arg(value)), true)
+}
+
+// HasKey only matches owners that have the given key
+func (q *HashMapQuery) HasKey(key string) *HashMapQuery {
+	return q.owns(fmt.Sprintf("attr ? %s::text", q.arg(key)), false)
+}
+
+// HasNotKey only matches owners that do not have the given key
+func (q *HashMapQuery) HasNotKey(key string) *HashMapQuery {
+	return q.owns(fmt.Sprintf("attr ? %s::text", q.arg(key)), true)
+}
+
+// HasAllKeys only matches owners that have all of the given keys
+func (q *HashMapQuery) HasAllKeys(keys ...string) *HashMapQuery {
+	// Each key of an owner may be stored in a separate row, so ?& can not be used
+	for _, key := range keys {
+		q.HasKey(key)
+	}
+	return q
+}
+
+// HasAnyKey only matches owners that have at least one of the given keys
+func (q *HashMapQuery) HasAnyKey(keys ...string) *HashMapQuery {
+	return q.owns(fmt.Sprintf("attr ?| %s::text[]", q.arg(pq.Array(keys))), false)
+}
+
+// Limit sets the maximum number of owners that are returned. 0 means no limit.
+func (q *HashMapQuery) Limit(n int) *HashMapQuery {
+	q.limit = n
+	return q
+}
+
+// Offset sets the number of owners that are skipped, in sorted order
+func (q *HashMapQuery) Offset(n int) *HashMapQuery {
+	q.offset = n
+	return q
+}
+
+// where returns the WHERE clause for the query
+func (q *HashMapQuery) where() string {
+	conditions := append([]string{"NOT " + expired(q.h.table, "o."+ownerCol)}, q.conditions...)
+	return strings.Join(conditions, " AND ")
+}
+
+// Owners returns the sorted owners that match all the conditions
+func (q *HashMapQuery) Owners(ctx context.Context) ([]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT o.%s FROM %s o WHERE %s ORDER BY o.%s", ownerCol, q.h.table, q.where(), ownerCol)
+	if q.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.limit)
+	}
+	if q.offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", q.offset)
+	}
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := q.h.host.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	owners := []string{}
+	for rows.Next() {
+		var owner string
+		if err := rows.Scan(&owner); err != nil {
+			return owners, err
+		}
+		owners = append(owners, owner)
+	}
+	return owners, rows.Err()
+}
+
+// Count returns the number of owners that match all the conditions.
+// Limit and Offset are ignored.
+func (q *HashMapQuery) Count(ctx context.Context) (int64, error) {
+	query := fmt.Sprintf("SELECT COUNT(DISTINCT o.%s) FROM %s o WHERE %s", ownerCol, q.h.table, q.where())
+	if Verbose {
+		fmt.Println(query)
+	}
+	var count int64
+	err := q.h.host.db.QueryRowContext(ctx, query, q.args...).Scan(&count)
+	return count, err
+}
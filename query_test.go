@@ -0,0 +1,65 @@
+package simplehstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHashMapQuery(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	hashmap.SetMap("alice", map[string]string{"role": "admin", "email": "alice@example.com"})
+	hashmap.SetMap("bob", map[string]string{"role": "admin", "banned": "true", "email": "bob@example.com"})
+	hashmap.SetMap("carol", map[string]string{"role": "admin", "banned": "false"})
+	hashmap.SetMap("dave", map[string]string{"role": "user", "email": "dave@example.com"})
+
+	ctx := context.Background()
+	owners, err := hashmap.Query().Where("role", "admin").WhereNot("banned", "true").HasKey("email").Limit(50).Owners(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0] != "alice" {
+		t.Errorf("Error, expected only alice, got %v", owners)
+	}
+
+	owners, err = hashmap.Query().HasAllKeys("role", "banned").Owners(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 2 || owners[0] != "bob" || owners[1] != "carol" {
+		t.Errorf("Error, expected bob and carol, got %v", owners)
+	}
+
+	owners, err = hashmap.Query().HasAnyKey("banned", "email").HasNotKey("role").Owners(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 0 {
+		t.Errorf("Error, expected no owners, got %v", owners)
+	}
+
+	count, err := hashmap.Query().Where("role", "admin").Limit(1).Count(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 3 {
+		t.Errorf("Error, expected 3 admins, got %d", count)
+	}
+
+	owners, err = hashmap.Query().Where("role", "admin").Limit(1).Offset(1).Owners(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0] != "bob" {
+		t.Errorf("Error, expected bob, got %v", owners)
+	}
+}
@@ -0,0 +1,325 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// The default number of times a job is dequeued before it is moved to the dead-letter queue
+	defaultMaxAttempts = 5
+	// The default delay before a job that is not acknowledged is retried for the first time
+	defaultRetryBackoff = time.Second
+	// The default longest delay before a job that is not acknowledged is retried
+	defaultMaxRetryBackoff = time.Hour
+	// The suffix for the name of the dead-letter queue table
+	deadLettersSuffix = "_dead_letters"
+)
+
+// ErrLeaseExpired is returned when a job is acknowledged after its visibility timeout has passed
+// and it has been dequeued again, or after it has already been acknowledged
+var ErrLeaseExpired = errors.New("the job is no longer leased")
+
+// Queue is a durable job queue, stored in PostgreSQL. Jobs are leased to one consumer at a time,
+// and are retried with exponential backoff until they are acknowledged or have been tried too many times,
+// after which they are moved to a dead-letter queue.
+type Queue struct {
+	host            *Host
+	table           string
+	deadLetters     string // the quoted name of the dead-letter table, or "" if this is a dead-letter queue
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+}
+
+// Job is a job that has been dequeued from a Queue
+type Job struct {
+	ID         int64
+	Payload    string
+	Priority   int
+	Attempts   int // the number of times the job has been dequeued, including this time
+	EnqueuedAt time.Time
+	LastError  string // the reason given the last time the job was not acknowledged
+}
+
+// EnqueueOptions are options for adding a job to a Queue
+type EnqueueOptions struct {
+	Delay    time.Duration // how long to wait before the job can be dequeued
+	Priority int           // jobs with a higher priority are dequeued first
+}
+
+// QueueStats is the number of jobs in a Queue, by state
+type QueueStats struct {
+	Ready       int64 // jobs that can be dequeued now
+	Delayed     int64 // jobs that are waiting for a delay or a retry
+	InFlight    int64 // jobs that are leased by a consumer
+	DeadLetters int64 // jobs in the dead-letter queue
+}
+
+// NewQueue creates a new job queue, together with a dead-letter queue.
+// Jobs are moved to the dead-letter queue after being dequeued 5 times without being acknowledged.
+func NewQueue(host *Host, name string) (*Queue, error) {
+	q := &Queue{
+		host:            host,
+		table:           pq.QuoteIdentifier(name), // name is the name of the table
+		deadLetters:     pq.QuoteIdentifier(name + deadLettersSuffix),
+		maxAttempts:     defaultMaxAttempts,
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+	}
+	for _, table := range []string{q.table, q.deadLetters} {
+		if err := createQueueTable(host, table); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// createQueueTable creates a table for a queue, if it is missing
+func createQueueTable(host *Host, table string) error {
+	for _, query := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGSERIAL PRIMARY KEY, payload %s NOT NULL, priority INTEGER NOT NULL DEFAULT 0, attempts INTEGER NOT NULL DEFAULT 0, leased BOOLEAN NOT NULL DEFAULT false, available_at TIMESTAMPTZ NOT NULL DEFAULT now(), %s TIMESTAMPTZ NOT NULL DEFAULT now(), last_error TEXT NOT NULL DEFAULT '')", table, defaultStringType, pq.QuoteIdentifier(createdAtCol)),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (priority DESC, available_at, id)", indexName(table, "dequeue"), table),
+	} {
+		if _, err := host.db.Exec(query); err != nil {
+			if !strings.HasSuffix(err.Error(), "already exists") {
+				return err
+			}
+		}
+	}
+	if Verbose {
+		log.Println("Created table " + table + " in database " + host.dbname)
+	}
+	return nil
+}
+
+// SetMaxAttempts sets how many times a job can be dequeued before it is moved to the dead-letter queue,
+// if it is not acknowledged. 0 means that jobs are retried forever.
+func (q *Queue) SetMaxAttempts(n int) {
+	q.maxAttempts = n
+}
+
+// SetRetryBackoff sets the delay before a job that is not acknowledged is retried for the first time,
+// and the longest delay. The delay is doubled for each attempt.
+func (q *Queue) SetRetryBackoff(initial, max time.Duration) {
+	q.retryBackoff = initial
+	q.maxRetryBackoff = max
+}
+
+// DeadLetters returns the dead-letter queue, where jobs end up after too many attempts.
+// Jobs in the dead-letter queue can be inspected and dequeued like in any other queue,
+// but are never moved further. Returns nil if this is a dead-letter queue.
+func (q *Queue) DeadLetters() *Queue {
+	if q.deadLetters == "" {
+		return nil
+	}
+	return &Queue{host: q.host, table: q.deadLetters, retryBackoff: q.retryBackoff, maxRetryBackoff: q.maxRetryBackoff}
+}
+
+// Enqueue adds a job to the queue, and returns the ID of the job.
+// Consumers that wait in Dequeue are notified.
+func (q *Queue) Enqueue(payload string, opts EnqueueOptions) (int64, error) {
+	if !q.host.rawUTF8 {
+		Encode(&payload)
+	}
+	query := fmt.Sprintf("WITH i AS (INSERT INTO %s (payload, priority, available_at) VALUES ($1, $2, now() + make_interval(secs => $3)) RETURNING id) SELECT id FROM i, pg_notify($4, '')", q.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	var id int64
+	err := q.host.db.QueryRow(query, payload, opts.Priority, opts.Delay.Seconds(), notifyChannel(q.table)).Scan(&id)
+	return id, err
+}
+
+// TryDequeue leases the next job that is ready, without waiting. The job is hidden from other consumers until
+// the visibility timeout has passed, and must be acknowledged with Ack before that, or it will be dequeued again.
+// Jobs with a higher priority are dequeued first. ErrNoAvailableValues is returned if no job is ready.
+func (q *Queue) TryDequeue(visibilityTimeout time.Duration) (*Job, error) {
+	columns := fmt.Sprintf("id, payload, priority, attempts, %s, last_error", pq.QuoteIdentifier(createdAtCol))
+	exhausted, moved, movedRows := "false", "", ""
+	if q.deadLetters != "" && q.maxAttempts > 0 {
+		// A job whose consumers have given up without calling Nack is moved to the dead-letter queue
+		// when its lease has expired and it is up next, instead of being leased again
+		exhausted = fmt.Sprintf("leased AND attempts >= %d", q.maxAttempts)
+		moved = fmt.Sprintf(", d AS (DELETE FROM %s WHERE id = (SELECT id FROM c WHERE exhausted) RETURNING %s), m AS (INSERT INTO %s (payload, priority, %s, last_error) SELECT payload, priority, %s, 'visibility timeout' FROM d)", q.table, columns, q.deadLetters, pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol))
+		movedRows = fmt.Sprintf(" UNION ALL SELECT true, %s FROM d", columns)
+	}
+	query := fmt.Sprintf("WITH c AS (SELECT id, %s AS exhausted FROM %s WHERE available_at <= now() ORDER BY priority DESC, available_at, id LIMIT 1 FOR UPDATE SKIP LOCKED)%s, u AS (UPDATE %s SET attempts = attempts + 1, leased = true, available_at = now() + make_interval(secs => $1) WHERE id = (SELECT id FROM c WHERE NOT exhausted) RETURNING %s) SELECT false, %s FROM u%s", exhausted, q.table, moved, q.table, columns, columns, movedRows)
+	if Verbose {
+		fmt.Println(query)
+	}
+	for {
+		var (
+			job      Job
+			wasMoved bool
+		)
+		if err := q.host.db.QueryRow(query, visibilityTimeout.Seconds()).Scan(&wasMoved, &job.ID, &job.Payload, &job.Priority, &job.Attempts, &job.EnqueuedAt, &job.LastError); err != nil {
+			if err == sql.ErrNoRows {
+				return nil, ErrNoAvailableValues
+			}
+			return nil, err
+		}
+		if wasMoved {
+			// Try the next job
+			continue
+		}
+		if !q.host.rawUTF8 {
+			Decode(&job.Payload)
+		}
+		return &job, nil
+	}
+}
+
+// Dequeue leases the next job that is ready, like TryDequeue, but waits until a job is ready or the context is done.
+// Waiting consumers are woken up by notifications from Enqueue and Nack, and check the queue
+// now and then in case notifications are lost.
+func (q *Queue) Dequeue(ctx context.Context, visibilityTimeout time.Duration) (*Job, error) {
+	channel := notifyChannel(q.table)
+	// Subscribe before checking the queue, so that no notification is missed
+	wake, unsubscribe := q.host.subscribe(channel)
+	defer unsubscribe()
+	for {
+		job, err := q.TryDequeue(visibilityTimeout)
+		if err != ErrNoAvailableValues {
+			return job, err
+		}
+		// Wake up when the next delayed job is ready, if that is sooner than the next poll
+		wait := q.host.pollInterval(channel)
+		next, err := q.nextAvailable()
+		if err != nil {
+			return nil, err
+		}
+		if next > 0 && next < wait {
+			wait = next
+		}
+		poll := time.NewTimer(wait)
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-ctx.Done():
+			poll.Stop()
+			return nil, ctx.Err()
+		}
+		poll.Stop()
+	}
+}
+
+// nextAvailable returns how long it is until the next job that is not ready becomes ready, or 0 if there is no such job
+func (q *Queue) nextAvailable() (time.Duration, error) {
+	var seconds sql.NullFloat64
+	if err := q.host.db.QueryRow(fmt.Sprintf("SELECT EXTRACT(EPOCH FROM MIN(available_at) - now()) FROM %s WHERE available_at > now()", q.table)).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// Ack acknowledges that a job is done, and removes it from the queue.
+// ErrLeaseExpired is returned if the job has been dequeued again in the meantime, or is already acknowledged.
+func (q *Queue) Ack(job *Job) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND attempts = $2", q.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := q.host.db.Exec(query, job.ID, job.Attempts)
+	if err != nil {
+		return err
+	}
+	return leaseResult(result)
+}
+
+// Nack reports that a job failed, with a reason. The job is retried after a delay that doubles for each attempt,
+// or moved to the dead-letter queue if it has been dequeued too many times.
+// ErrLeaseExpired is returned if the job has been dequeued again in the meantime, or is already acknowledged.
+func (q *Queue) Nack(job *Job, reason string) error {
+	if q.deadLetters != "" && q.maxAttempts > 0 && job.Attempts >= q.maxAttempts {
+		query := fmt.Sprintf("WITH d AS (DELETE FROM %s WHERE id = $1 AND attempts = $2 RETURNING payload, priority, %s) INSERT INTO %s (payload, priority, %s, last_error) SELECT payload, priority, %s, $3 FROM d", q.table, pq.QuoteIdentifier(createdAtCol), q.deadLetters, pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol))
+		if Verbose {
+			fmt.Println(query)
+		}
+		result, err := q.host.db.Exec(query, job.ID, job.Attempts, reason)
+		if err != nil {
+			return err
+		}
+		return leaseResult(result)
+	}
+	query := fmt.Sprintf("UPDATE %s SET leased = false, available_at = now() + make_interval(secs => $3), last_error = $4 WHERE id = $1 AND attempts = $2", q.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := q.host.db.Exec(query, job.ID, job.Attempts, q.backoff(job.Attempts).Seconds(), reason)
+	if err != nil {
+		return err
+	}
+	if err := leaseResult(result); err != nil {
+		return err
+	}
+	// Let waiting consumers know when the job will be ready again
+	_, err = q.host.db.Exec("SELECT pg_notify($1, '')", notifyChannel(q.table))
+	return err
+}
+
+// backoff returns the delay before a job is retried, after the given number of attempts
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.retryBackoff
+	for i := 1; i < attempts && delay < q.maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxRetryBackoff {
+		delay = q.maxRetryBackoff
+	}
+	return delay
+}
+
+// leaseResult returns ErrLeaseExpired if no job was affected
+func leaseResult(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+// Stats returns the number of jobs in the queue, by state
+func (q *Queue) Stats() (QueueStats, error) {
+	var stats QueueStats
+	query := fmt.Sprintf("SELECT COUNT(*) FILTER (WHERE available_at <= now()), COUNT(*) FILTER (WHERE available_at > now() AND NOT leased), COUNT(*) FILTER (WHERE available_at > now() AND leased) FROM %s", q.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if err := q.host.db.QueryRow(query).Scan(&stats.Ready, &stats.Delayed, &stats.InFlight); err != nil {
+		return stats, err
+	}
+	if q.deadLetters == "" {
+		return stats, nil
+	}
+	err := q.host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", q.deadLetters)).Scan(&stats.DeadLetters)
+	return stats, err
+}
+
+// Remove this queue, together with the dead-letter queue
+func (q *Queue) Remove() error {
+	tables := q.table
+	if q.deadLetters != "" {
+		tables += ", " + q.deadLetters
+	}
+	// Remove the tables
+	_, err := q.host.db.Exec(fmt.Sprintf("DROP TABLE %s", tables))
+	return err
+}
+
+// Clear the queue contents. The dead-letter queue is kept.
+func (q *Queue) Clear() error {
+	// Clear the table
+	_, err := q.host.db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", q.table))
+	return err
+}
@@ -0,0 +1,187 @@
+package simplehstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueueBackoff(t *testing.T) {
+	q := &Queue{retryBackoff: time.Second, maxRetryBackoff: 10 * time.Second}
+	for attempts, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 100: 10 * time.Second} {
+		if delay := q.backoff(attempts); delay != expected {
+			t.Errorf("Error, expected a delay of %s after %d attempts, got %s", expected, attempts, delay)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	q, err := NewCreator(host).NewQueue("queue_test_jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Remove()
+	q.Clear()
+	q.DeadLetters().Clear()
+	q.SetMaxAttempts(2)
+	q.SetRetryBackoff(10*time.Millisecond, time.Second)
+
+	if _, err := q.TryDequeue(time.Minute); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues, got: %v", err)
+	}
+	if _, err := q.Enqueue("low", EnqueueOptions{}); err != nil {
+		t.Error(err)
+	}
+	if _, err := q.Enqueue("high", EnqueueOptions{Priority: 10}); err != nil {
+		t.Error(err)
+	}
+	if _, err := q.Enqueue("later", EnqueueOptions{Delay: time.Hour, Priority: 100}); err != nil {
+		t.Error(err)
+	}
+	if stats, err := q.Stats(); err != nil || stats != (QueueStats{Ready: 2, Delayed: 1}) {
+		t.Errorf("Error, unexpected stats: %+v (%v)", stats, err)
+	}
+
+	ctx := context.Background()
+	job, err := q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Payload != "high" || job.Attempts != 1 {
+		t.Errorf("Error, expected the high priority job first, got %+v", job)
+	}
+	if err := q.Ack(job); err != nil {
+		t.Error(err)
+	}
+	if err := q.Ack(job); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Error, expected ErrLeaseExpired, got: %v", err)
+	}
+
+	// Fail the low priority job until it ends up in the dead-letter queue
+	job, err = q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := q.Stats(); err != nil || stats != (QueueStats{Delayed: 1, InFlight: 1}) {
+		t.Errorf("Error, unexpected stats: %+v (%v)", stats, err)
+	}
+	if err := q.Nack(job, "first failure"); err != nil {
+		t.Error(err)
+	}
+	// Waits for the retry delay
+	job, err = q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Payload != "low" || job.Attempts != 2 || job.LastError != "first failure" {
+		t.Errorf("Error, expected a retry of the low priority job, got %+v", job)
+	}
+	if err := q.Nack(job, "second failure"); err != nil {
+		t.Error(err)
+	}
+	if stats, err := q.Stats(); err != nil || stats != (QueueStats{Delayed: 1, DeadLetters: 1}) {
+		t.Errorf("Error, unexpected stats: %+v (%v)", stats, err)
+	}
+	dead, err := q.DeadLetters().TryDequeue(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dead.Payload != "low" || dead.LastError != "second failure" {
+		t.Errorf("Error, unexpected dead letter: %+v", dead)
+	}
+
+	// A job whose visibility timeout passes can be dequeued again
+	if _, err := q.Enqueue("slow", EnqueueOptions{}); err != nil {
+		t.Error(err)
+	}
+	job, err = q.Dequeue(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := q.Dequeue(ctx, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != job.ID || again.Attempts != 2 {
+		t.Errorf("Error, expected the same job again, got %+v", again)
+	}
+	if err := q.Ack(job); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Error, expected ErrLeaseExpired for the expired lease, got: %v", err)
+	}
+	if err := q.Ack(again); err != nil {
+		t.Error(err)
+	}
+
+	// Waiting consumers are woken up by Enqueue
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := q.Enqueue("wake up", EnqueueOptions{}); err != nil {
+			t.Error(err)
+		}
+	}()
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if job, err := q.Dequeue(timeoutCtx, time.Minute); err != nil || job.Payload != "wake up" {
+		t.Errorf("Error, expected the new job, got %+v (%v)", job, err)
+	}
+	shortCtx, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := q.Dequeue(shortCtx, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error, expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestQueueExpiredLeases(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	q, err := NewQueue(host, "queue_test_leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Remove()
+	q.Clear()
+	q.DeadLetters().Clear()
+	q.SetMaxAttempts(2)
+
+	if _, err := q.Enqueue("abandoned", EnqueueOptions{Priority: 1}); err != nil {
+		t.Error(err)
+	}
+	if _, err := q.Enqueue("next", EnqueueOptions{}); err != nil {
+		t.Error(err)
+	}
+	// The consumers give up without calling Ack or Nack, until the job has been dequeued too many times
+	for i := 0; i < 2; i++ {
+		job, err := q.TryDequeue(10 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Payload != "abandoned" {
+			t.Errorf("Error, expected the abandoned job, got %+v", job)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// The abandoned job is moved to the dead-letter queue instead of being leased again
+	job, err := q.TryDequeue(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Payload != "next" {
+		t.Errorf("Error, expected the next job, got %+v", job)
+	}
+	dead, err := q.DeadLetters().TryDequeue(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dead.Payload != "abandoned" || dead.LastError != "visibility timeout" {
+		t.Errorf("Error, unexpected dead letter: %+v", dead)
+	}
+}
@@ -0,0 +1,306 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Renaming owners and keys. Each rename is done in a single transaction, and the table is
+// locked against other writes while renaming. If the new owner or key already exists,
+// an error that wraps ErrAlreadyExists is returned, unless overwrite is true.
+
+// RenameOwner gives all keys and values of an owner to a new owner, for instance when a user changes username.
+// The expiry time of the owner, if any, is kept.
+func (h *HashMap) RenameOwner(oldOwner, newOwner string, overwrite bool) error {
+	ctx := context.Background()
+	return h.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := lockWithTransaction(ctx, transaction, h.table); err != nil {
+			return err
+		}
+		for _, owner := range []string{oldOwner, newOwner} {
+			if _, err := execWithTransaction(ctx, transaction, h.purgeExpiredQuery(), h.table, owner); err != nil {
+				return err
+			}
+		}
+		ownerExists := fmt.Sprintf("SELECT 1 FROM %s WHERE %s = $1", h.table, ownerCol)
+		found, err := existsWithTransaction(ctx, transaction, ownerExists, oldOwner)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrOwnerDoesNotExist, oldOwner)
+		}
+		if oldOwner == newOwner {
+			return nil
+		}
+		found, err = existsWithTransaction(ctx, transaction, ownerExists, newOwner)
+		if err != nil {
+			return err
+		}
+		if found {
+			if !overwrite {
+				return fmt.Errorf("%w: %s", ErrAlreadyExists, newOwner)
+			}
+			if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", h.table, ownerCol), newOwner); err != nil {
+				return err
+			}
+		}
+		if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable)), h.table, newOwner); err != nil {
+			return err
+		}
+		if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET %s = $2 WHERE %s = $1", h.table, ownerCol, ownerCol), oldOwner, newOwner); err != nil {
+			return err
+		}
+		_, err = execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET k = $3 WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable)), h.table, oldOwner, newOwner)
+		return err
+	})
+}
+
+// RenameKey renames a key for the given owner, while keeping the value
+func (h *HashMap) RenameKey(owner, oldKey, newKey string, overwrite bool) error {
+	ctx := context.Background()
+	return h.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := lockWithTransaction(ctx, transaction, h.table); err != nil {
+			return err
+		}
+		if _, err := execWithTransaction(ctx, transaction, h.purgeExpiredQuery(), h.table, owner); err != nil {
+			return err
+		}
+		keyExists := fmt.Sprintf("SELECT 1 FROM %s WHERE %s = $1 AND attr ? $2::text", h.table, ownerCol)
+		found, err := existsWithTransaction(ctx, transaction, keyExists, owner, oldKey)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", ErrKeyDoesNotExist, oldKey)
+		}
+		if oldKey == newKey {
+			return nil
+		}
+		found, err = existsWithTransaction(ctx, transaction, keyExists, owner, newKey)
+		if err != nil {
+			return err
+		}
+		if found {
+			if !overwrite {
+				return fmt.Errorf("%w: %s", ErrAlreadyExists, newKey)
+			}
+			if err := h.delKeysWithTransaction(ctx, transaction, []string{newKey}, ownerCol+" = $2", owner); err != nil {
+				return err
+			}
+		}
+		_, err = execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET attr = delete(attr, $2::text) || hstore($3::text, attr -> $2::text) WHERE %s = $1 AND attr ? $2::text", h.table, ownerCol), owner, oldKey, newKey)
+		return uniqueViolation(err, h.Indexes(), newKey)
+	})
+}
+
+// RenameKeyForAll renames a key for all owners that have it, while keeping the values.
+// This is useful when migrating a property to a new name.
+func (h *HashMap) RenameKeyForAll(oldKey, newKey string, overwrite bool) error {
+	if oldKey == newKey {
+		return nil
+	}
+	ctx := context.Background()
+	return h.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := lockWithTransaction(ctx, transaction, h.table); err != nil {
+			return err
+		}
+		if !overwrite {
+			// Look for an owner that already has the new key
+			query := fmt.Sprintf("SELECT o.%s FROM %s o WHERE o.attr ? $1::text AND NOT %s AND EXISTS (SELECT 1 FROM %s c WHERE c.%s = o.%s AND c.attr ? $2::text) LIMIT 1", ownerCol, h.table, expired(h.table, "o."+ownerCol), h.table, ownerCol, ownerCol)
+			if Verbose {
+				fmt.Println(query)
+			}
+			var owner string
+			err := transaction.QueryRowContext(ctx, query, oldKey, newKey).Scan(&owner)
+			if err == nil {
+				return fmt.Errorf("%w: %s for %s", ErrAlreadyExists, newKey, owner)
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+		}
+		// Only expired owners have both keys if overwrite is false
+		if err := h.delKeysWithTransaction(ctx, transaction, []string{newKey}, fmt.Sprintf("%s IN (SELECT %s FROM %s WHERE attr ? $2::text)", ownerCol, ownerCol, h.table), oldKey); err != nil {
+			return err
+		}
+		_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET attr = delete(attr, $1::text) || hstore($2::text, attr -> $1::text) WHERE attr ? $1::text", h.table), oldKey, newKey)
+		return uniqueViolation(err, h.Indexes(), newKey)
+	})
+}
+
+// renameEntries renames all keys in the key/value table that match the given LIKE pattern, in a single transaction.
+// rename returns the new name for each of the found keys. If no keys are found, notFound is returned.
+// If targetPattern is not empty, all other keys that match it are treated as already existing, not only the new names.
+// If newProperty is not empty, it is added to the property set. If updateUnique is not nil, it is called with
+// the new names. Both are done as part of the transaction.
+func (hm2 *HashMap2) renameEntries(pattern, targetPattern string, rename func(string) string, overwrite bool, notFound error, newProperty string, updateUnique func(context.Context, *sql.Tx, []string) error) error {
+	table := pq.QuoteIdentifier(kvPrefix + hm2.table)
+	ctx := context.Background()
+	return hm2.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := lockWithTransaction(ctx, transaction, table); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("SELECT e.key, e.value FROM %s, LATERAL each(attr) e WHERE e.key LIKE $1", table)
+		if Verbose {
+			fmt.Println(query)
+		}
+		rows, err := transaction.QueryContext(ctx, query, pattern)
+		if err != nil {
+			return err
+		}
+		var oldKeys, newKeys, values []string
+		for rows.Next() {
+			var key string
+			var value sql.NullString
+			if err := rows.Scan(&key, &value); err != nil {
+				rows.Close()
+				return err
+			}
+			oldKeys = append(oldKeys, key)
+			newKeys = append(newKeys, rename(key))
+			values = append(values, value.String)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(oldKeys) == 0 {
+			return notFound
+		}
+		// Find the new keys that already exist, and are not about to be renamed
+		query = fmt.Sprintf("SELECT k FROM %s, LATERAL skeys(attr) AS k WHERE k = ANY($1::text[]) AND NOT k = ANY($2::text[])", table)
+		target := interface{}(pq.Array(newKeys))
+		if targetPattern != "" {
+			query = fmt.Sprintf("SELECT k FROM %s, LATERAL skeys(attr) AS k WHERE k LIKE $1 AND NOT k = ANY($2::text[])", table)
+			target = targetPattern
+		}
+		if Verbose {
+			fmt.Println(query)
+		}
+		rows, err = transaction.QueryContext(ctx, query, target, pq.Array(oldKeys))
+		if err != nil {
+			return err
+		}
+		var existingKeys []string
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			existingKeys = append(existingKeys, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(existingKeys) > 0 && !overwrite {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, strings.Replace(existingKeys[0], fieldSep, "/", 1))
+		}
+		query = fmt.Sprintf("UPDATE %s SET attr = delete(attr, $1::text[]) || hstore($2::text[], $3::text[])", table)
+		if _, err := execWithTransaction(ctx, transaction, query, pq.Array(append(oldKeys, existingKeys...)), pq.Array(newKeys), pq.Array(values)); err != nil {
+			return err
+		}
+		if newProperty != "" {
+			if err := hm2.propSet().addWithTransactionNoCheck(ctx, transaction, newProperty); err != nil {
+				return err
+			}
+		}
+		if updateUnique == nil {
+			return nil
+		}
+		return updateUnique(ctx, transaction, newKeys)
+	})
+}
+
+// renameUniqueKey returns a function that updates the registered unique values when
+// oldKey is renamed to newKey, or nil if there are no keys that must have unique values
+func (hm2 *HashMap2) renameUniqueKey(oldKey, newKey string) (func(context.Context, *sql.Tx, []string) error, error) {
+	uniqueKeys, err := hm2.uniqueKeys()
+	if err != nil || len(uniqueKeys) == 0 {
+		return nil, err
+	}
+	return func(ctx context.Context, transaction *sql.Tx, newKeys []string) error {
+		owners := make([]string, len(newKeys))
+		for i, key := range newKeys {
+			owners[i] = key[:strings.Index(key, fieldSep)]
+		}
+		query := fmt.Sprintf("DELETE FROM %s WHERE k = ANY($1::text[]) AND %s = ANY($2::text[])", hm2.uniqueValuesTable(), ownerCol)
+		if _, err := execWithTransaction(ctx, transaction, query, pq.Array([]string{oldKey, newKey}), pq.Array(owners)); err != nil {
+			return err
+		}
+		if !hasS(uniqueKeys, newKey) {
+			return nil
+		}
+		query = fmt.Sprintf("INSERT INTO %s (k, v, %s) SELECT $1, e.value, split_part(e.key, '%s', 1) FROM %s, LATERAL each(attr) e WHERE e.key = ANY($2::text[])", hm2.uniqueValuesTable(), ownerCol, fieldSep, pq.QuoteIdentifier(kvPrefix+hm2.table))
+		if _, err := execWithTransaction(ctx, transaction, query, newKey, pq.Array(newKeys)); err != nil {
+			if _, ok := isUniqueViolation(err); ok {
+				return &UniqueViolationError{newKey}
+			}
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// RenameOwner gives all keys and values of an owner to a new owner, for instance when a user changes username.
+// If the new owner already exists, it is replaced if overwrite is true.
+func (hm2 *HashMap2) RenameOwner(oldOwner, newOwner string, overwrite bool) error {
+	if strings.Contains(newOwner, fieldSep) {
+		return fmt.Errorf("owner can not contain %s", fieldSep)
+	}
+	uniqueKeys, err := hm2.uniqueKeys()
+	if err != nil {
+		return err
+	}
+	var updateUnique func(context.Context, *sql.Tx, []string) error
+	if len(uniqueKeys) > 0 && oldOwner != newOwner {
+		updateUnique = func(ctx context.Context, transaction *sql.Tx, _ []string) error {
+			if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", hm2.uniqueValuesTable(), ownerCol), newOwner); err != nil {
+				return err
+			}
+			_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("UPDATE %s SET %s = $2 WHERE %s = $1", hm2.uniqueValuesTable(), ownerCol, ownerCol), oldOwner, newOwner)
+			return err
+		}
+	}
+	rename := func(key string) string {
+		return newOwner + strings.TrimPrefix(key, oldOwner)
+	}
+	return hm2.renameEntries(escapeLike(oldOwner+fieldSep)+"%", escapeLike(newOwner+fieldSep)+"%", rename, overwrite, fmt.Errorf("%w: %s", ErrOwnerDoesNotExist, oldOwner), "", updateUnique)
+}
+
+// RenameKey renames a key for the given owner, while keeping the value
+func (hm2 *HashMap2) RenameKey(owner, oldKey, newKey string, overwrite bool) error {
+	if strings.Contains(newKey, fieldSep) {
+		return fmt.Errorf("key can not contain %s", fieldSep)
+	}
+	updateUnique, err := hm2.renameUniqueKey(oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	rename := func(string) string {
+		return owner + fieldSep + newKey
+	}
+	return hm2.renameEntries(escapeLike(owner+fieldSep+oldKey), "", rename, overwrite, fmt.Errorf("%w: %s", ErrKeyDoesNotExist, oldKey), newKey, updateUnique)
+}
+
+// RenameKeyForAll renames a key for all owners that have it, while keeping the values.
+// This is useful when migrating a property to a new name.
+func (hm2 *HashMap2) RenameKeyForAll(oldKey, newKey string, overwrite bool) error {
+	if strings.Contains(newKey, fieldSep) {
+		return fmt.Errorf("key can not contain %s", fieldSep)
+	}
+	updateUnique, err := hm2.renameUniqueKey(oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	rename := func(key string) string {
+		return strings.TrimSuffix(key, oldKey) + newKey
+	}
+	return hm2.renameEntries("%"+escapeLike(fieldSep+oldKey), "", rename, overwrite, nil, newKey, updateUnique)
+}
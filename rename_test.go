@@ -0,0 +1,229 @@
+package simplehstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHashMapRename(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap(host, "rename_test_users")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.SetMap("bob", map[string]string{"email": "bob@example.com", "password": "hunter1"}); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+
+	if err := users.RenameOwner("bob", "alice", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := users.RenameOwner("nobody", "somebody", false); !errors.Is(err, ErrOwnerDoesNotExist) {
+		t.Errorf("Error, expected ErrOwnerDoesNotExist, got: %v", err)
+	}
+	if err := users.RenameOwner("bob", "robert", false); err != nil {
+		t.Error(err)
+	}
+	if exists, err := users.Exists("bob"); err != nil || exists {
+		t.Errorf("Error, bob should no longer exist (%v)", err)
+	}
+	if password, err := users.Get("robert", "password"); err != nil || password != "hunter1" {
+		t.Errorf("Error, expected hunter1, got %s (%v)", password, err)
+	}
+	if err := users.RenameOwner("robert", "alice", true); err != nil {
+		t.Error(err)
+	}
+	if email, err := users.Get("alice", "email"); err != nil || email != "bob@example.com" {
+		t.Errorf("Error, expected bob@example.com, got %s (%v)", email, err)
+	}
+
+	if err := users.RenameKey("alice", "password", "email", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := users.RenameKey("alice", "missing", "other", false); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got: %v", err)
+	}
+	if err := users.RenameKey("alice", "password", "secret", false); err != nil {
+		t.Error(err)
+	}
+	if has, err := users.Has("alice", "password"); err != nil || has {
+		t.Errorf("Error, the password key should be gone (%v)", err)
+	}
+	if secret, err := users.Get("alice", "secret"); err != nil || secret != "hunter1" {
+		t.Errorf("Error, expected hunter1, got %s (%v)", secret, err)
+	}
+
+	if err := users.Set("carol", "email", "carol@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("carol", "mail", "carol@example.org"); err != nil {
+		t.Error(err)
+	}
+	if err := users.RenameKeyForAll("email", "mail", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := users.RenameKeyForAll("email", "mail", true); err != nil {
+		t.Error(err)
+	}
+	// The rows that only had the overwritten key are gone
+	var emptyRows int
+	if err := host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE attr = ''::hstore", users.table)).Scan(&emptyRows); err != nil || emptyRows != 0 {
+		t.Errorf("Error, expected no empty rows, got %d (%v)", emptyRows, err)
+	}
+	for owner, expected := range map[string]string{"alice": "bob@example.com", "carol": "carol@example.com"} {
+		if mail, err := users.Get(owner, "mail"); err != nil || mail != expected {
+			t.Errorf("Error, expected %s, got %s (%v)", expected, mail, err)
+		}
+		if has, err := users.Has(owner, "email"); err != nil || has {
+			t.Errorf("Error, the email key should be gone for %s (%v)", owner, err)
+		}
+	}
+}
+
+func TestHashMap2Rename(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap2(host, "rename_test_users2")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.SetMap("bob", map[string]string{"email": "bob@example.com", "password": "hunter1"}); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.SetUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+
+	if err := users.RenameOwner("bob", "alice", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := users.RenameOwner("nobody", "somebody", false); !errors.Is(err, ErrOwnerDoesNotExist) {
+		t.Errorf("Error, expected ErrOwnerDoesNotExist, got: %v", err)
+	}
+	if err := users.RenameOwner("bob", "robert", false); err != nil {
+		t.Error(err)
+	}
+	if exists, err := users.Exists("bob"); err != nil || exists {
+		t.Errorf("Error, bob should no longer exist (%v)", err)
+	}
+	if password, err := users.Get("robert", "password"); err != nil || password != "hunter1" {
+		t.Errorf("Error, expected hunter1, got %s (%v)", password, err)
+	}
+	// The unique email now belongs to robert
+	if err := users.Set("alice", "email", "bob@example.com"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+
+	if err := users.RenameKey("robert", "password", "email", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := users.RenameKey("robert", "missing", "other", false); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got: %v", err)
+	}
+	if err := users.RenameKey("robert", "password", "secret", false); err != nil {
+		t.Error(err)
+	}
+	if has, err := users.Has("robert", "password"); err != nil || has {
+		t.Errorf("Error, the password key should be gone (%v)", err)
+	}
+	keys, err := users.Keys("robert")
+	if err != nil {
+		t.Error(err)
+	}
+	if !hasS(keys, "secret") {
+		t.Errorf("Error, expected the secret key among %v", keys)
+	}
+
+	if err := users.RenameKeyForAll("email", "mail", false); err != nil {
+		t.Error(err)
+	}
+	if mail, err := users.Get("alice", "mail"); err != nil || mail != "alice@example.com" {
+		t.Errorf("Error, expected alice@example.com, got %s (%v)", mail, err)
+	}
+	// The old email addresses are no longer reserved, since mail is not a unique key
+	if err := users.Set("alice", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+
+	// Failed renames do not add the new key to the possible keys
+	if err := users.RenameKey("robert", "missing", "ghost", false); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got: %v", err)
+	}
+	if has, err := users.propSet().Has("ghost"); err != nil || has {
+		t.Errorf("Error, ghost should not be a possible key (%v)", err)
+	}
+}
+
+func TestHashMap2RenameOwnerDisjointKeys(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap2(host, "rename_test_disjoint")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.SetUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("dave", "phone", "12345"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("erin", "email", "erin@example.com"); err != nil {
+		t.Error(err)
+	}
+
+	// The owners have no keys in common, but erin already exists
+	if err := users.RenameOwner("dave", "erin", false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if email, err := users.Get("erin", "email"); err != nil || email != "erin@example.com" {
+		t.Errorf("Error, erin should be unchanged, got %s (%v)", email, err)
+	}
+	if has, err := users.Has("erin", "phone"); err != nil || has {
+		t.Errorf("Error, the owners should not be merged (%v)", err)
+	}
+	// The unique email of erin is still reserved
+	if err := users.Set("frank", "email", "erin@example.com"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+
+	// With overwrite, erin is replaced, and the email is no longer reserved
+	if err := users.RenameOwner("dave", "erin", true); err != nil {
+		t.Error(err)
+	}
+	keys, err := users.Keys("erin")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(keys) != 1 || keys[0] != "phone" {
+		t.Errorf("Error, expected only the phone key, got %v", keys)
+	}
+	if err := users.Set("frank", "email", "erin@example.com"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,250 @@
+package simplehstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// defaultScanPageSize is the number of keys or owners that are fetched per query, when scanning
+const defaultScanPageSize = 100
+
+// Scanner iterates over keys or owners that match a pattern, one page at a time.
+// The keys or owners are returned in sorted order.
+type Scanner struct {
+	ctx      context.Context
+	fetch    func(ctx context.Context, cursor string, limit int) ([]string, error)
+	pageSize int
+	page     []string
+	pos      int
+	cursor   string
+	done     bool
+	err      error
+}
+
+// newScanner creates a new Scanner, given a function that can fetch
+// up to limit sorted values that are larger than the given cursor.
+func newScanner(ctx context.Context, pageSize int, fetch func(ctx context.Context, cursor string, limit int) ([]string, error)) *Scanner {
+	if pageSize <= 0 {
+		pageSize = defaultScanPageSize
+	}
+	return &Scanner{ctx: ctx, fetch: fetch, pageSize: pageSize}
+}
+
+// Next advances to the next key or owner, and returns false when there are no more or an error occurred
+func (s *Scanner) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.pos+1 < len(s.page) {
+		s.pos++
+		s.cursor = s.page[s.pos]
+		return true
+	}
+	if s.done {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return false
+	}
+	page, err := s.fetch(s.ctx, s.cursor, s.pageSize)
+	if err != nil {
+		s.err = err
+		return false
+	}
+	if len(page) < s.pageSize {
+		s.done = true
+	}
+	if len(page) == 0 {
+		return false
+	}
+	s.page = page
+	s.pos = 0
+	s.cursor = page[0]
+	return true
+}
+
+// Value returns the current key or owner
+func (s *Scanner) Value() string {
+	if s.pos < len(s.page) {
+		return s.page[s.pos]
+	}
+	return ""
+}
+
+// Cursor returns the position of the scan, which is the last returned key or owner.
+// It can be passed to Seek, for continuing the scan later on.
+func (s *Scanner) Cursor() string {
+	return s.cursor
+}
+
+// Seek makes the scan continue after the given cursor
+func (s *Scanner) Seek(cursor string) {
+	s.cursor = cursor
+	s.page = nil
+	s.pos = 0
+	s.done = false
+	s.err = nil
+}
+
+// Err returns the error that stopped the scan, if any
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// All returns all the remaining keys or owners
+func (s *Scanner) All() ([]string, error) {
+	values := []string{}
+	for s.Next() {
+		values = append(values, s.Value())
+	}
+	return values, s.Err()
+}
+
+// globToLike converts a Redis-style glob pattern (with *, ? and \ for escaping)
+// to an SQL LIKE pattern. Returns false if the pattern uses character classes,
+// which LIKE does not support.
+func globToLike(pattern string) (string, bool) {
+	var sb strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if escaped {
+			escaped = false
+			switch r {
+			case '%', '_', '\\':
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+			continue
+		}
+		switch r {
+		case '\\':
+			escaped = true
+		case '[':
+			return "", false
+		case '*':
+			sb.WriteRune('%')
+		case '?':
+			sb.WriteRune('_')
+		case '%', '_':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if escaped {
+		// A trailing backslash matches itself
+		sb.WriteString("\\\\")
+	}
+	return sb.String(), true
+}
+
+// globToRegex converts a Redis-style glob pattern (with *, ?, [abc], [^a], [a-z] and \ for escaping)
+// to an anchored PostgreSQL regular expression
+func globToRegex(pattern string) string {
+	var sb strings.Builder
+	sb.WriteRune('^')
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				r = runes[i]
+			}
+			writeRegexLiteral(&sb, r)
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteRune('.')
+		case '[':
+			// Find the closing bracket
+			end := -1
+			for j := i + 1; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					j++
+					continue
+				}
+				if runes[j] == ']' && j > i+1 && !(j == i+2 && runes[i+1] == '^') {
+					end = j
+					break
+				}
+			}
+			if end == -1 {
+				// No closing bracket, so this is a literal [
+				writeRegexLiteral(&sb, r)
+				continue
+			}
+			sb.WriteRune('[')
+			j := i + 1
+			if runes[j] == '^' {
+				sb.WriteRune('^')
+				j++
+			}
+			for ; j < end; j++ {
+				c := runes[j]
+				if c == '\\' && j+1 < end {
+					j++
+					c = runes[j]
+				} else if c == '-' {
+					// A range, such as a-z
+					sb.WriteRune(c)
+					continue
+				}
+				switch c {
+				case '\\', '[', ']', '^', '-':
+					sb.WriteRune('\\')
+				}
+				sb.WriteRune(c)
+			}
+			sb.WriteRune(']')
+			i = end
+		default:
+			writeRegexLiteral(&sb, r)
+		}
+	}
+	sb.WriteRune('$')
+	return sb.String()
+}
+
+// writeRegexLiteral writes a rune that should be matched literally by a regular expression
+func writeRegexLiteral(sb *strings.Builder, r rune) {
+	if strings.ContainsRune(`.^$|()[]{}*+?\`, r) {
+		sb.WriteRune('\\')
+	}
+	sb.WriteRune(r)
+}
+
+// globMatch returns an SQL operator and an argument for matching
+// an SQL expression against a Redis-style glob pattern
+func globMatch(pattern string) (string, string) {
+	if like, ok := globToLike(pattern); ok {
+		return "LIKE", like
+	}
+	return "~", globToRegex(pattern)
+}
+
+// scanStrings runs a query that takes a cursor, a pattern, a limit and
+// optionally more arguments, and returns the resulting strings
+func scanStrings(ctx context.Context, host *Host, query, cursor, pattern string, limit int, args ...interface{}) ([]string, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := host.db.QueryContext(ctx, query, append([]interface{}{cursor, pattern, limit}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,81 @@
+package simplehstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGlobToLike(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"user:*":      "user:%",
+		"a?c":         "a_c",
+		"50%_off":     "50\\%\\_off",
+		"a\\*b":       "a*b",
+		"back\\\\":    "back\\\\",
+		"plain":       "plain",
+		"trailing\\":  "trailing\\\\",
+		"\\%literal*": "\\%literal%",
+	} {
+		like, ok := globToLike(pattern)
+		if !ok {
+			t.Errorf("Error, could not convert %q to a LIKE pattern", pattern)
+		}
+		if like != expected {
+			t.Errorf("Error, %q should be converted to %q, but got %q", pattern, expected, like)
+		}
+	}
+	if _, ok := globToLike("h[ae]llo"); ok {
+		t.Error("Error, character classes can not be converted to LIKE patterns")
+	}
+}
+
+func TestGlobToRegex(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"h[ae]llo":  "^h[ae]llo$",
+		"h[^e]llo":  "^h[^e]llo$",
+		"h[a-b]llo": "^h[a-b]llo$",
+		"a.b*":      "^a\\.b.*$",
+		"x?(y)":     "^x.\\(y\\)$",
+		"[\\]]":     "^[\\]]$",
+		"[\\d]":     "^[d]$",
+		"open[":     "^open\\[$",
+		"$[]":       "^\\$\\[\\]$",
+	} {
+		if regex := globToRegex(pattern); regex != expected {
+			t.Errorf("Error, %q should be converted to %q, but got %q", pattern, expected, regex)
+		}
+	}
+}
+
+func TestScannerPages(t *testing.T) {
+	all := []string{"a", "b", "c", "d", "e"}
+	fetch := func(ctx context.Context, cursor string, limit int) ([]string, error) {
+		var page []string
+		for _, v := range all {
+			if v > cursor && len(page) < limit {
+				page = append(page, v)
+			}
+		}
+		return page, nil
+	}
+	s := newScanner(context.Background(), 2, fetch)
+	if !s.Next() || s.Value() != "a" || !s.Next() || s.Value() != "b" {
+		t.Error("Error, the first page should be a and b")
+	}
+	cursor := s.Cursor()
+	rest, err := s.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(rest) != 3 || rest[0] != "c" || rest[2] != "e" {
+		t.Errorf("Error, expected c, d and e, got %v", rest)
+	}
+	s.Seek(cursor)
+	rest, err = s.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(rest) != 3 {
+		t.Errorf("Error, expected to continue after %s, got %v", cursor, rest)
+	}
+}
@@ -0,0 +1,141 @@
+package simplehstore
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Full-text search, using tsvector and tsquery. The search queries are parsed with
+// websearch_to_tsquery, so "quoted phrases", "or" and "-excluded" words are supported.
+// The values must be stored as raw UTF-8, see Host.SetRawUTF8. Requires PostgreSQL 12 or later.
+
+// SearchResult is an owner in a HashMap or an element in a List that matches a search query,
+// together with how well it matches, as calculated by ts_rank. A higher rank is a better match.
+type SearchResult struct {
+	Value string
+	Rank  float64
+}
+
+// searchConfig returns the text search configuration as an SQL literal
+func (host *Host) searchConfig() string {
+	config := host.textSearchConfig
+	if config == "" {
+		config = defaultTextSearchConfig
+	}
+	return fmt.Sprintf("'%s'::regconfig", escapeSingleQuotes(config))
+}
+
+// searchVector returns an SQL expression for the tsvector of the given key in the attr column
+func (h *HashMap) searchVector(key string) string {
+	return fmt.Sprintf("to_tsvector(%s, COALESCE(attr -> '%s', ''))", h.host.searchConfig(), escapeSingleQuotes(key))
+}
+
+// Search returns the owners where the value of the given key matches the given search query,
+// together with their rank, with the best matches first. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (h *HashMap) Search(key, query string) ([]SearchResult, error) {
+	if !h.host.rawUTF8 {
+		return []SearchResult{}, ErrNotRawUTF8
+	}
+	vector := h.searchVector(key)
+	sqlQuery := fmt.Sprintf("SELECT %s, MAX(ts_rank(%s, q)) AS rank FROM %s, websearch_to_tsquery(%s, $1) q WHERE attr ? '%s' AND %s @@ q AND NOT %s GROUP BY %s ORDER BY rank DESC, %s", ownerCol, vector, h.table, h.host.searchConfig(), escapeSingleQuotes(key), vector, h.expired(), ownerCol, ownerCol)
+	return searchResults(h.host, sqlQuery, query)
+}
+
+// CreateSearchIndex creates a GIN index for full-text search of the values of the given key.
+// The index is created with the current text search configuration, see Host.SetTextSearchConfig.
+func (h *HashMap) CreateSearchIndex(key string) error {
+	query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)", indexName(h.table, "search", key), h.table, h.searchVector(key))
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := h.host.db.Exec(query)
+	return err
+}
+
+// RemoveSearchIndex removes the index created by CreateSearchIndex
+func (h *HashMap) RemoveSearchIndex(key string) error {
+	query := fmt.Sprintf("DROP INDEX IF EXISTS %s", indexName(h.table, "search", key))
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := h.host.db.Exec(query)
+	return err
+}
+
+// searchColumn returns the name of the generated tsvector column for a List
+func searchColumn() string {
+	return pq.QuoteIdentifier(listCol + "_tsv")
+}
+
+// hasSearchColumn checks if CreateSearchIndex has added a tsvector column to this list
+func (l *List) hasSearchColumn() (bool, error) {
+	return l.hasColumn(listCol + "_tsv")
+}
+
+// Search returns the elements in the list that match the given search query, together with their rank,
+// with the best matches first. Requires raw UTF-8 mode, see Host.SetRawUTF8.
+func (l *List) Search(query string) ([]SearchResult, error) {
+	if !l.host.rawUTF8 {
+		return []SearchResult{}, ErrNotRawUTF8
+	}
+	// Use the generated column, if it has been created by CreateSearchIndex
+	vector := fmt.Sprintf("to_tsvector(%s, COALESCE(%s, ''))", l.host.searchConfig(), listCol)
+	if found, err := l.hasSearchColumn(); err != nil {
+		return []SearchResult{}, err
+	} else if found {
+		vector = searchColumn()
+	}
+	sqlQuery := fmt.Sprintf("SELECT %s, ts_rank(%s, q) AS rank FROM %s, websearch_to_tsquery(%s, $1) q WHERE %s @@ q ORDER BY rank DESC, %s", listCol, vector, l.table, l.host.searchConfig(), vector, listOrder())
+	return searchResults(l.host, sqlQuery, query)
+}
+
+// CreateSearchIndex adds a generated tsvector column to the list, together with a GIN index,
+// for faster full-text search. The column is generated with the current text search configuration,
+// see Host.SetTextSearchConfig.
+func (l *List) CreateSearchIndex() error {
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (to_tsvector(%s, COALESCE(%s, ''))) STORED", l.table, searchColumn(), l.host.searchConfig(), listCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := l.host.db.Exec(query); err != nil {
+		return err
+	}
+	query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)", indexName(l.table, "search"), l.table, searchColumn())
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := l.host.db.Exec(query)
+	return err
+}
+
+// RemoveSearchIndex removes the column and index created by CreateSearchIndex
+func (l *List) RemoveSearchIndex() error {
+	query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", l.table, searchColumn())
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := l.host.db.Exec(query)
+	return err
+}
+
+// searchResults runs a search query that returns strings in the first column and a rank in the second
+func searchResults(host *Host, sqlQuery, query string) ([]SearchResult, error) {
+	if Verbose {
+		fmt.Println(sqlQuery)
+	}
+	rows, err := host.db.Query(sqlQuery, query)
+	if err != nil {
+		return []SearchResult{}, err
+	}
+	defer rows.Close()
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		if err := rows.Scan(&result.Value, &result.Rank); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
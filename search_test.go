@@ -0,0 +1,95 @@
+package simplehstore
+
+import (
+	"testing"
+)
+
+func TestHashMapSearch(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	hashmap, err := NewHashMap(host, hashmapname)
+	if err != nil {
+		t.Error(err)
+	}
+	hashmap.Clear()
+	defer hashmap.Remove()
+
+	if _, err := hashmap.Search("bio", "cats"); err != ErrNotRawUTF8 {
+		t.Errorf("Error, expected ErrNotRawUTF8, got %v", err)
+	}
+
+	host.SetRawUTF8(true)
+	defer host.SetRawUTF8(false)
+
+	hashmap.Set("alice", "bio", "I like cats and dogs. Cats are the best.")
+	hashmap.Set("bob", "bio", "Dogs are great")
+	hashmap.Set("carol", "bio", "I have a cat")
+	hashmap.Set("dave", "notes", "cats")
+
+	if err := hashmap.CreateSearchIndex("bio"); err != nil {
+		t.Error(err)
+	}
+	defer hashmap.RemoveSearchIndex("bio")
+
+	owners, err := hashmap.Search("bio", "cat")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 2 || owners[0].Value != "alice" || owners[1].Value != "carol" {
+		t.Errorf("Error, expected alice and carol, got %v", owners)
+	} else if owners[0].Rank <= owners[1].Rank || owners[1].Rank <= 0 {
+		t.Errorf("Error, expected alice to be ranked higher than carol, got %v", owners)
+	}
+	owners, err = hashmap.Search("bio", "dogs -cats")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(owners) != 1 || owners[0].Value != "bob" {
+		t.Errorf("Error, expected only bob, got %v", owners)
+	}
+}
+
+func TestListSearch(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+	host.SetRawUTF8(true)
+	host.SetTextSearchConfig("simple")
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Clear()
+	defer list.Remove()
+
+	list.Add("connection refused")
+	list.Add("connection established")
+	list.Add("request served")
+
+	for i := 0; i < 2; i++ {
+		values, err := list.Search("connection")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(values) != 2 || values[0].Value != "connection refused" || values[0].Rank <= 0 {
+			t.Errorf("Error, expected two connection log lines, got %v", values)
+		}
+		values, err = list.Search(`"request served" or refused`)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(values) != 2 {
+			t.Errorf("Error, expected two log lines, got %v", values)
+		}
+		// Search once more, but with the generated column and index
+		if err := list.CreateSearchIndex(); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := list.RemoveSearchIndex(); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,7 +3,6 @@ package simplehstore
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -14,7 +13,8 @@ import (
 // Set is a set of strings, stored in PostgreSQL
 type Set dbDatastructure
 
-// NewSet creates a new set
+// NewSet creates a new set. Existing set tables are upgraded with a unique index,
+// and any duplicate elements are removed.
 func NewSet(host *Host, name string) (*Set, error) {
 	s := &Set{host, pq.QuoteIdentifier(name)} // name is the name of the table
 	// list is the name of the column
@@ -26,63 +26,135 @@ func NewSet(host *Host, name string) (*Set, error) {
 	if Verbose {
 		log.Println("Created table " + s.table + " in database " + host.dbname)
 	}
+	if err := s.createUniqueIndex(); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
+// hashed returns an SQL condition that is true if the element column equals the given expression.
+// The hash is compared first, so that the unique index can be used.
+func hashed(expr string) string {
+	return fmt.Sprintf("md5(%s) = md5(%s) AND %s = %s", setCol, expr, setCol, expr)
+}
+
+// createUniqueIndex removes duplicate elements and adds a unique index, for sets that were created by older versions.
+// The index is on a hash of the elements, so that there is no limit to how long an element can be.
+func (s *Set) createUniqueIndex() error {
+	var found bool
+	if err := s.host.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_class WHERE oid = to_regclass($1))", indexName(s.table, setCol, "md5")).Scan(&found); err != nil || found {
+		return err
+	}
+	ctx := context.Background()
+	return s.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if err := lockWithTransaction(ctx, transaction, s.table); err != nil {
+			return err
+		}
+		for _, query := range []string{
+			fmt.Sprintf("DELETE FROM %s a USING %s b WHERE a.ctid < b.ctid AND a.%s = b.%s", s.table, s.table, setCol, setCol),
+			fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (md5(%s))", indexName(s.table, setCol, "md5"), s.table, setCol),
+		} {
+			if _, err := execWithTransaction(ctx, transaction, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Add an element to the set
 func (s *Set) Add(value string) error {
-	originalValue := value
+	_, err := s.TryAdd(value)
+	return err
+}
+
+// TryAdd adds an element to the set. Returns true if the element was added, or false if it was already there.
+func (s *Set) TryAdd(value string) (bool, error) {
 	if !s.host.rawUTF8 {
 		Encode(&value)
 	}
-	// Check that the value is not already there before adding
-	has, err := s.Has(originalValue)
-	if !has || noResult(err) {
-		_, err = s.host.db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1)", s.table, setCol), value)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1) ON CONFLICT DO NOTHING", s.table, setCol)
+	if Verbose {
+		fmt.Println(query)
 	}
-	return err
+	result, err := s.host.db.Exec(query, value)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
 }
 
-// Add an element to the set, with a transaction, without checking if it exists already
+// Add an element to the set, with a transaction. Does nothing if the element is already there.
 func (s *Set) addWithTransactionNoCheck(ctx context.Context, transaction *sql.Tx, value string) error {
 	if !s.host.rawUTF8 {
 		Encode(&value)
 	}
-	_, err := transaction.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1)", s.table, setCol), value)
+	_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1) ON CONFLICT DO NOTHING", s.table, setCol), value)
 	return err
 }
 
+// encoded returns the given elements, encoded the way they are stored
+func (s *Set) encoded(values []string) []string {
+	encoded := make([]string, len(values))
+	copy(encoded, values)
+	if !s.host.rawUTF8 {
+		for i := range encoded {
+			Encode(&encoded[i])
+		}
+	}
+	return encoded
+}
+
+// AddMany adds several elements to the set. Returns the number of elements that were not already there.
+func (s *Set) AddMany(values []string) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT DISTINCT unnest($1::text[]) ON CONFLICT DO NOTHING", s.table, setCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := s.host.db.Exec(query, pq.Array(s.encoded(values)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Has checks if the given value is in the set
 func (s *Set) Has(value string) (bool, error) {
 	if !s.host.rawUTF8 {
 		Encode(&value)
 	}
-	rows, err := s.host.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1", setCol, s.table, setCol), value)
-	if err != nil {
-		return false, err
+	var found bool
+	err := s.host.db.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s)", s.table, hashed("$1")), value).Scan(&found)
+	return found, err
+}
+
+// HasMany checks if each of the given values is in the set. The results are in the same order as the values.
+func (s *Set) HasMany(values []string) ([]bool, error) {
+	found := make([]bool, 0, len(values))
+	if len(values) == 0 {
+		return found, nil
 	}
-	if rows == nil {
-		return false, errors.New("Set Has returned no rows for value " + value)
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s) FROM unnest($1::text[]) WITH ORDINALITY AS input(v, i) ORDER BY input.i", s.table, hashed("input.v"))
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := s.host.db.Query(query, pq.Array(s.encoded(values)))
+	if err != nil {
+		return found, err
 	}
 	defer rows.Close()
-	var scanValue sql.NullString
-	// Get the value. Should not loop more than once.
-	counter := 0
 	for rows.Next() {
-		err = rows.Scan(&scanValue)
-		if err != nil {
-			// No rows
-			return false, err
+		var has bool
+		if err := rows.Scan(&has); err != nil {
+			return found, err
 		}
-		counter++
-	}
-	if err := rows.Err(); err != nil {
-		return false, err
+		found = append(found, has)
 	}
-	//if counter > 1 {
-	// more than one element that has the same *value* is fine!
-	//}
-	return counter > 0, nil
+	return found, rows.Err()
 }
 
 // All returns all elements in the set
@@ -91,7 +163,7 @@ func (s *Set) All() ([]string, error) {
 		values []string
 		value  sql.NullString
 	)
-	rows, err := s.host.db.Query(fmt.Sprintf("SELECT DISTINCT %s FROM %s", setCol, s.table))
+	rows, err := s.host.db.Query(fmt.Sprintf("SELECT %s FROM %s", setCol, s.table))
 	if err != nil {
 		return values, err
 	}
@@ -114,6 +186,31 @@ func (s *Set) All() ([]string, error) {
 	return values, err
 }
 
+// values runs a query that returns set elements, and returns the decoded elements
+func (s *Set) values(query string, args ...interface{}) ([]string, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	values := []string{}
+	rows, err := s.host.db.Query(query, args...)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			return values, err
+		}
+		vs := value.String
+		if !s.host.rawUTF8 {
+			Decode(&vs)
+		}
+		values = append(values, vs)
+	}
+	return values, rows.Err()
+}
+
 // GetAll is deprecated in favor of All
 func (s *Set) GetAll() ([]string, error) {
 	return s.All()
@@ -125,10 +222,26 @@ func (s *Set) Del(value string) error {
 		Encode(&value)
 	}
 	// Remove a value from the table
-	_, err := s.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = '%s'", s.table, setCol, value))
+	_, err := s.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", s.table, hashed("$1")), value)
 	return err
 }
 
+// DelMany removes several elements from the set. Returns the number of elements that were removed.
+func (s *Set) DelMany(values []string) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE md5(%s) IN (SELECT md5(v) FROM unnest($1::text[]) AS v) AND %s = ANY($1::text[])", s.table, setCol, setCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := s.host.db.Exec(query, pq.Array(s.encoded(values)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Remove this set
 func (s *Set) Remove() error {
 	// Remove the table
@@ -146,7 +259,7 @@ func (s *Set) Clear() error {
 // Count counts the number of elements in this list
 func (s *Set) Count() (int, error) {
 	var value sql.NullInt32
-	rows, err := s.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", setCol, s.table))
+	rows, err := s.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table))
 	if err != nil {
 		return 0, err
 	}
@@ -166,7 +279,7 @@ func (s *Set) Count() (int, error) {
 // CountInt64 counts the number of elements in this list (int64)
 func (s *Set) CountInt64() (int64, error) {
 	var value sql.NullInt64
-	rows, err := s.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s) as temp", setCol, s.table))
+	rows, err := s.host.db.Query(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table))
 	if err != nil {
 		return 0, err
 	}
@@ -1,6 +1,8 @@
 package simplehstore
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/xyproto/pinterface"
@@ -171,3 +173,93 @@ func TestCount(t *testing.T) {
 		t.Error("The set should have length 2 after adding two different items")
 	}
 }
+
+func TestSetUpgrade(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	// A set table from an older version, with duplicates and no unique index
+	set, err := NewSet(host, setname)
+	if err != nil {
+		t.Error(err)
+	}
+	set.Remove()
+	if _, err := host.db.Exec(fmt.Sprintf("CREATE TABLE %s (%s %s)", set.table, setCol, defaultStringType)); err != nil {
+		t.Fatal(err)
+	}
+	// Elements that are too long for a regular index, even when compressed
+	r := rand.New(rand.NewSource(1))
+	long := make([]byte, 10000)
+	for i := range long {
+		long[i] = byte('a' + r.Intn(26))
+	}
+	for _, value := range []string{"a", "a", "a", string(long)} {
+		Encode(&value)
+		if _, err := host.db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1)", set.table, setCol), value); err != nil {
+			t.Error(err)
+		}
+	}
+	set, err = NewSet(host, setname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Remove()
+	if count, err := set.Count(); err != nil || count != 2 {
+		t.Errorf("Error, expected the duplicates to be removed, got %d elements (%v)", count, err)
+	}
+	if found, err := set.Has(string(long)); err != nil || !found {
+		t.Errorf("Error, expected the long element to be in the set (%v)", err)
+	}
+	if added, err := set.TryAdd(string(long)); err != nil || added {
+		t.Errorf("Error, the long element should already be in the set (%v)", err)
+	}
+	if err := set.Del(string(long)); err != nil {
+		t.Error(err)
+	}
+	if added, err := set.TryAdd("a"); err != nil || added {
+		t.Errorf("Error, a should already be in the set (%v)", err)
+	}
+	if added, err := set.TryAdd("b"); err != nil || !added {
+		t.Errorf("Error, b should have been added (%v)", err)
+	}
+}
+
+func TestSetMany(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	set, err := NewSet(host, setname)
+	if err != nil {
+		t.Error(err)
+	}
+	set.Clear()
+	defer set.Remove()
+
+	if err := set.Add("a"); err != nil {
+		t.Error(err)
+	}
+	if n, err := set.AddMany([]string{"a", "b", "c", "c"}); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 new elements, got %d (%v)", n, err)
+	}
+	found, err := set.HasMany([]string{"c", "x", "a"})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(found) != 3 || !found[0] || found[1] || !found[2] {
+		t.Errorf("Error, unexpected result from HasMany: %v", found)
+	}
+	if n, err := set.DelMany([]string{"a", "x", "b"}); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 removed elements, got %d (%v)", n, err)
+	}
+	items, err := set.All()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(items) != 1 || items[0] != "c" {
+		t.Errorf("Error, unexpected elements: %v", items)
+	}
+}
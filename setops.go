@@ -0,0 +1,86 @@
+package simplehstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// combineQuery returns a query that combines the elements of this set with the elements of
+// the other sets, with the given SQL set operator (UNION, INTERSECT or EXCEPT).
+// All sets must be on the same Host, since the elements are combined by the database.
+func (s *Set) combineQuery(operator string, others []*Set) (string, error) {
+	selects := []string{fmt.Sprintf("SELECT %s FROM %s", setCol, s.table)}
+	for _, other := range others {
+		if other.host != s.host {
+			return "", fmt.Errorf("%w: %s and %s", ErrDifferentHosts, s.table, other.table)
+		}
+		selects = append(selects, fmt.Sprintf("SELECT %s FROM %s", setCol, other.table))
+	}
+	// The operators remove duplicates, and are applied from left to right
+	return strings.Join(selects, " "+operator+" "), nil
+}
+
+// combine returns the elements of this set, combined with the elements of the other sets
+func (s *Set) combine(operator string, others []*Set) ([]string, error) {
+	query, err := s.combineQuery(operator, others)
+	if err != nil {
+		return []string{}, err
+	}
+	return s.values(query)
+}
+
+// combineStore stores the elements of this set, combined with the elements of the other sets, in dst.
+// The previous contents of dst are replaced, in a single statement. dst may be one of the combined sets.
+// Returns the number of elements in dst.
+func (s *Set) combineStore(operator string, dst *Set, others []*Set) (int64, error) {
+	if dst.host != s.host {
+		return 0, fmt.Errorf("%w: %s and %s", ErrDifferentHosts, s.table, dst.table)
+	}
+	query, err := s.combineQuery(operator, others)
+	if err != nil {
+		return 0, err
+	}
+	// All parts of the statement see the sets as they were before the statement, and the order in which
+	// the data-modifying parts run is undefined, so the elements that are already in dst are kept
+	// instead of being removed and added again, which would violate the unique index
+	query = fmt.Sprintf("WITH result AS (%s), added AS (INSERT INTO %s (%s) SELECT %s FROM result ON CONFLICT DO NOTHING), removed AS (DELETE FROM %s d WHERE NOT EXISTS (SELECT 1 FROM result WHERE result.%s = d.%s)) SELECT COUNT(*) FROM result", query, dst.table, setCol, setCol, dst.table, setCol, setCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	var count int64
+	err = s.host.db.QueryRow(query).Scan(&count)
+	return count, err
+}
+
+// Union returns the elements that are in this set or in any of the other sets
+func (s *Set) Union(others ...*Set) ([]string, error) {
+	return s.combine("UNION", others)
+}
+
+// Intersect returns the elements that are in this set and in all of the other sets
+func (s *Set) Intersect(others ...*Set) ([]string, error) {
+	return s.combine("INTERSECT", others)
+}
+
+// Diff returns the elements that are in this set, but not in any of the other sets
+func (s *Set) Diff(others ...*Set) ([]string, error) {
+	return s.combine("EXCEPT", others)
+}
+
+// UnionStore replaces the contents of dst with the elements that are in this set or in any of the other sets.
+// Returns the number of elements in dst.
+func (s *Set) UnionStore(dst *Set, others ...*Set) (int64, error) {
+	return s.combineStore("UNION", dst, others)
+}
+
+// InterStore replaces the contents of dst with the elements that are in this set and in all of the other sets.
+// Returns the number of elements in dst.
+func (s *Set) InterStore(dst *Set, others ...*Set) (int64, error) {
+	return s.combineStore("INTERSECT", dst, others)
+}
+
+// DiffStore replaces the contents of dst with the elements that are in this set, but not in any of the other sets.
+// Returns the number of elements in dst.
+func (s *Set) DiffStore(dst *Set, others ...*Set) (int64, error) {
+	return s.combineStore("EXCEPT", dst, others)
+}
@@ -0,0 +1,106 @@
+package simplehstore
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSetOperations(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	sets := make(map[string]*Set)
+	for name, elements := range map[string][]string{
+		"setops_test_a": {"a", "b", "c", "d"},
+		"setops_test_b": {"c", "d", "e"},
+		"setops_test_c": {"d", "e", "f"},
+	} {
+		set, err := NewSet(host, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.Clear()
+		defer set.Remove()
+		for _, element := range elements {
+			if err := set.Add(element); err != nil {
+				t.Error(err)
+			}
+		}
+		sets[name] = set
+	}
+	a, b, c := sets["setops_test_a"], sets["setops_test_b"], sets["setops_test_c"]
+	dst, err := NewSet(host, "setops_test_dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst.Clear()
+	defer dst.Remove()
+	if err := dst.Add("old"); err != nil {
+		t.Error(err)
+	}
+
+	sorted := func(values []string, err error) string {
+		if err != nil {
+			t.Error(err)
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	}
+	if result := sorted(a.Union(b, c)); result != "a,b,c,d,e,f" {
+		t.Errorf("Error, unexpected union: %s", result)
+	}
+	if result := sorted(a.Intersect(b, c)); result != "d" {
+		t.Errorf("Error, unexpected intersection: %s", result)
+	}
+	if result := sorted(a.Diff(b, c)); result != "a,b" {
+		t.Errorf("Error, unexpected difference: %s", result)
+	}
+	if result := sorted(a.Union()); result != "a,b,c,d" {
+		t.Errorf("Error, unexpected union with no other sets: %s", result)
+	}
+
+	if n, err := a.InterStore(dst, b); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 stored elements, got %d (%v)", n, err)
+	}
+	if result := sorted(dst.All()); result != "c,d" {
+		t.Errorf("Error, unexpected stored intersection: %s", result)
+	}
+	// The destination can be one of the sets
+	if n, err := dst.UnionStore(dst, c); err != nil || n != 4 {
+		t.Errorf("Error, expected 4 stored elements, got %d (%v)", n, err)
+	}
+	if result := sorted(dst.All()); result != "c,d,e,f" {
+		t.Errorf("Error, unexpected stored union: %s", result)
+	}
+	if n, err := a.DiffStore(dst, dst); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 stored elements, got %d (%v)", n, err)
+	}
+	if result := sorted(dst.All()); result != "a,b" {
+		t.Errorf("Error, unexpected stored difference: %s", result)
+	}
+
+	// Elements in dst that are also in the result are kept, and the others are removed
+	if _, err := dst.AddMany([]string{"a", "c", "x"}); err != nil {
+		t.Error(err)
+	}
+	if n, err := a.UnionStore(dst, b); err != nil || n != 5 {
+		t.Errorf("Error, expected 5 stored elements, got %d (%v)", n, err)
+	}
+	if result := sorted(dst.All()); result != "a,b,c,d,e" {
+		t.Errorf("Error, unexpected union stored in a non-empty set: %s", result)
+	}
+
+	otherHost := NewHost(defaultConnectionString)
+	defer otherHost.Close()
+	other, err := NewSet(otherHost, "setops_test_b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Union(other); !errors.Is(err, ErrDifferentHosts) {
+		t.Errorf("Error, expected ErrDifferentHosts, got: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package simplehstore
+
+import (
+	"fmt"
+)
+
+// RandomMember returns a random element from the set, without removing it, like SRANDMEMBER in Redis.
+// ErrNoAvailableValues is returned if the set is empty.
+func (s *Set) RandomMember() (string, error) {
+	values, err := s.RandomMembers(1, true)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrNoAvailableValues
+	}
+	return values[0], nil
+}
+
+// RandomMembers returns n random elements from the set, without removing them, like SRANDMEMBER with a count in Redis.
+// If distinct is true, each element is returned at most once, and fewer than n elements are returned
+// if the set is smaller than n. If distinct is false, the same element may be returned several times,
+// and exactly n elements are returned, unless the set is empty.
+func (s *Set) RandomMembers(n int, distinct bool) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	if distinct {
+		return s.values(fmt.Sprintf("SELECT %s FROM %s ORDER BY random() LIMIT $1", setCol, s.table), n)
+	}
+	// random() is evaluated once per generated row, so each pick is independent
+	return s.values(fmt.Sprintf("WITH m AS (SELECT array_agg(%s) AS a FROM %s) SELECT a[1 + floor(random() * cardinality(a))::int] FROM m, generate_series(1, $1) WHERE cardinality(a) > 0", setCol, s.table), n)
+}
+
+// Pop removes and returns a random element from the set, like SPOP in Redis.
+// ErrNoAvailableValues is returned if the set is empty.
+func (s *Set) Pop() (string, error) {
+	values, err := s.PopN(1)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", ErrNoAvailableValues
+	}
+	return values[0], nil
+}
+
+// PopN removes and returns up to n random elements from the set, like SPOP with a count in Redis.
+// Elements that are locked by other transactions are skipped, so that several consumers can pop from
+// the same set without getting the same elements. If the set has fewer than n elements, all of them are returned.
+func (s *Set) PopN(n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+	return s.values(fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT %s FROM %s ORDER BY random() LIMIT $1 FOR UPDATE SKIP LOCKED) RETURNING %s", s.table, setCol, setCol, s.table, setCol), n)
+}
@@ -0,0 +1,91 @@
+package simplehstore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetRandom(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	set, err := NewSet(host, setname)
+	if err != nil {
+		t.Error(err)
+	}
+	set.Clear()
+	defer set.Remove()
+
+	if _, err := set.RandomMember(); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues for an empty set, got: %v", err)
+	}
+	if values, err := set.RandomMembers(3, false); err != nil || len(values) != 0 {
+		t.Errorf("Error, expected no elements from an empty set, got %v (%v)", values, err)
+	}
+	if _, err := set.Pop(); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues for an empty set, got: %v", err)
+	}
+
+	if _, err := set.AddMany([]string{"a", "b", "c"}); err != nil {
+		t.Error(err)
+	}
+	member, err := set.RandomMember()
+	if err != nil {
+		t.Error(err)
+	}
+	if has, err := set.Has(member); err != nil || !has {
+		t.Errorf("Error, %q should be in the set (%v)", member, err)
+	}
+	values, err := set.RandomMembers(5, true)
+	if err != nil {
+		t.Error(err)
+	}
+	sort.Strings(values)
+	if strings.Join(values, ",") != "a,b,c" {
+		t.Errorf("Error, expected all distinct elements, got %v", values)
+	}
+	values, err = set.RandomMembers(5, false)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(values) != 5 {
+		t.Errorf("Error, expected 5 elements, got %v", values)
+	}
+	for _, value := range values {
+		if value != "a" && value != "b" && value != "c" {
+			t.Errorf("Error, unexpected element: %q", value)
+		}
+	}
+
+	// Pop from several goroutines, and check that each element is only popped once
+	var (
+		mut    sync.Mutex
+		popped []string
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := set.PopN(2)
+			if err != nil {
+				t.Error(err)
+			}
+			mut.Lock()
+			popped = append(popped, values...)
+			mut.Unlock()
+		}()
+	}
+	wg.Wait()
+	sort.Strings(popped)
+	if strings.Join(popped, ",") != "a,b,c" {
+		t.Errorf("Error, expected each element to be popped once, got %v", popped)
+	}
+	if count, err := set.Count(); err != nil || count != 0 {
+		t.Errorf("Error, expected an empty set, got %d elements (%v)", count, err)
+	}
+}
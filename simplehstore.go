@@ -4,11 +4,13 @@
 package simplehstore
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 
 	// Using the PostgreSQL database engine
 	pq "github.com/lib/pq"
@@ -22,6 +24,8 @@ const (
 	defaultStringType = "TEXT"
 	defaultPort       = 5432
 	encoding          = "UTF8"
+
+	defaultTextSearchConfig = "english"
 )
 
 // Host represents a PostgreSQL database
@@ -29,10 +33,24 @@ type Host struct {
 	db     *sql.DB
 	dbname string
 
+	// The connection string that was used for connecting, needed for listening to notifications
+	connectionString string
+
 	// If set to true, any UTF-8 string will be let through as it is.
 	// Some UTF-8 strings may be unpalatable for PostgreSQL when performing
 	// SQL queries. The default is "false".
 	rawUTF8 bool
+
+	// The text search configuration that is used for full-text search, like "english"
+	textSearchConfig string
+
+	// For stopping the background goroutine that removes expired entries
+	reaperMut  sync.Mutex
+	reaperStop chan struct{}
+	reaperDone chan struct{}
+
+	// For waking up consumers that are waiting for new elements
+	notifier notifier
 }
 
 // Common for each of the db data structures used here
@@ -59,6 +77,20 @@ var (
 	ErrNoAvailableValues = errors.New("no available values")
 	// ErrTooFewResults is used as an error if an SQL query returns too few results
 	ErrTooFewResults = errors.New("too few results")
+	// ErrKeyDoesNotExist is used as an error if a key does not exist
+	ErrKeyDoesNotExist = errors.New("key does not exist")
+	// ErrOwnerDoesNotExist is used as an error if an owner in a hash map does not exist
+	ErrOwnerDoesNotExist = errors.New("owner does not exist")
+	// ErrAlreadyExists is used as an error if a key or owner is about to be overwritten, but that is not allowed
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrIndexOutOfRange is used as an error if there is no element at the given position in a list
+	ErrIndexOutOfRange = errors.New("index out of range")
+	// ErrValueNotFound is used as an error if a value that is searched for is not in a list or sorted set
+	ErrValueNotFound = errors.New("value not found")
+	// ErrDifferentHosts is used as an error if data structures on different hosts are combined by the database
+	ErrDifferentHosts = errors.New("the data structures must use the same host")
+	// ErrNotRawUTF8 is used as an error if values must be compared by the database, but are encoded
+	ErrNotRawUTF8 = errors.New("the values are encoded, use SetRawUTF8(true) for comparing values in the database")
 
 	// Column names
 	listCol  = "a_list"
@@ -143,7 +175,7 @@ func NewHost2(connectionString string) (*Host, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to %s", newConnectionString)
 	}
-	host := &Host{db, pq.QuoteIdentifier(dbname), false}
+	host := &Host{db: db, dbname: pq.QuoteIdentifier(dbname), connectionString: newConnectionString}
 	if err := host.Ping(); err != nil {
 		return nil, fmt.Errorf("database host does not reply to ping: %s", err)
 	}
@@ -172,7 +204,7 @@ func NewHostWithDSN2(connectionString string, dbname string) (*Host, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to %s", connectionString)
 	}
-	host := &Host{db, pq.QuoteIdentifier(dbname), false}
+	host := &Host{db: db, dbname: pq.QuoteIdentifier(dbname), connectionString: connectionString}
 	if err := host.Ping(); err != nil {
 		return nil, fmt.Errorf("database host does not reply to ping: %s", err)
 	}
@@ -203,6 +235,13 @@ func (host *Host) SetRawUTF8(enabled bool) {
 	host.rawUTF8 = enabled
 }
 
+// SetTextSearchConfig selects the PostgreSQL text search configuration that is used for full-text search,
+// like "english" or "simple". The default is "english". Search indexes that have already been created
+// keep using the configuration they were created with.
+func (host *Host) SetTextSearchConfig(config string) {
+	host.textSearchConfig = config
+}
+
 // SelectDatabase sets a different database name and creates the database if needed.
 func (host *Host) SelectDatabase(dbname string) error {
 	host.dbname = dbname
@@ -235,8 +274,10 @@ func (host *Host) Database() *sql.DB {
 	return host.db
 }
 
-// Close the connection
+// Close the connection, and stop the background reaper and the listener for notifications, if they are running
 func (host *Host) Close() {
+	host.StopReaper()
+	host.stopListener()
 	host.db.Close()
 }
 
@@ -244,3 +285,17 @@ func (host *Host) Close() {
 func (host *Host) Ping() error {
 	return host.db.Ping()
 }
+
+// withTransaction calls f with a new transaction, and commits the transaction if f returns nil.
+// If f returns an error, the transaction is rolled back and the error is returned.
+func (host *Host) withTransaction(ctx context.Context, f func(*sql.Tx) error) error {
+	transaction, err := host.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(transaction); err != nil {
+		transaction.Rollback()
+		return err
+	}
+	return transaction.Commit()
+}
@@ -0,0 +1,273 @@
+package simplehstore
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// The name of the column that has the score of each member in a SortedSet
+const scoreCol = "score"
+
+// SortedSet is a set of strings where each member has a score, stored in PostgreSQL.
+// The members are sorted by score. Members with the same score are sorted by how they are stored.
+type SortedSet dbDatastructure
+
+// ScoredMember is a member of a SortedSet, together with its score
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// NewSortedSet creates a new sorted set
+func NewSortedSet(host *Host, name string) (*SortedSet, error) {
+	z := &SortedSet{host, pq.QuoteIdentifier(name)} // name is the name of the table
+	for _, query := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s PRIMARY KEY, %s DOUBLE PRECISION NOT NULL)", z.table, setCol, defaultStringType, scoreCol),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s, %s)", indexName(z.table, scoreCol), z.table, scoreCol, setCol),
+	} {
+		if _, err := z.host.db.Exec(query); err != nil {
+			if !strings.HasSuffix(err.Error(), "already exists") {
+				return nil, err
+			}
+		}
+	}
+	if Verbose {
+		log.Println("Created table " + z.table + " in database " + host.dbname)
+	}
+	return z, nil
+}
+
+// scored runs a query that returns members and scores, and returns the decoded members with their scores
+func (z *SortedSet) scored(query string, args ...interface{}) ([]ScoredMember, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	members := []ScoredMember{}
+	rows, err := z.host.db.Query(query, args...)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			member sql.NullString
+			score  float64
+		)
+		if err := rows.Scan(&member, &score); err != nil {
+			return members, err
+		}
+		s := member.String
+		if !z.host.rawUTF8 {
+			Decode(&s)
+		}
+		members = append(members, ScoredMember{s, score})
+	}
+	return members, rows.Err()
+}
+
+// Add a member with the given score to the sorted set, or update the score if the member is already there
+func (z *SortedSet) Add(member string, score float64) error {
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2) ON CONFLICT (%s) DO UPDATE SET %s = EXCLUDED.%s", z.table, setCol, scoreCol, setCol, scoreCol, scoreCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := z.host.db.Exec(query, member, score)
+	return err
+}
+
+// IncrBy adds delta to the score of a member, like ZINCRBY in Redis, and returns the new score.
+// Members that are not in the sorted set are added with delta as the score.
+func (z *SortedSet) IncrBy(member string, delta float64) (float64, error) {
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	query := fmt.Sprintf("INSERT INTO %s AS z (%s, %s) VALUES ($1, $2) ON CONFLICT (%s) DO UPDATE SET %s = z.%s + EXCLUDED.%s RETURNING %s", z.table, setCol, scoreCol, setCol, scoreCol, scoreCol, scoreCol, scoreCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	var score float64
+	err := z.host.db.QueryRow(query, member, delta).Scan(&score)
+	return score, err
+}
+
+// Score returns the score of a member. An error that wraps ErrValueNotFound is returned if the member is not in the sorted set.
+func (z *SortedSet) Score(member string) (float64, error) {
+	originalMember := member
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	var score float64
+	err := z.host.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1", scoreCol, z.table, setCol), member).Scan(&score)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrValueNotFound, originalMember)
+	}
+	return score, err
+}
+
+// Has checks if the given member is in the sorted set
+func (z *SortedSet) Has(member string) (bool, error) {
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	var found bool
+	err := z.host.db.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1)", z.table, setCol), member).Scan(&found)
+	return found, err
+}
+
+// rank returns the number of members that are sorted before (or after, if comparison is ">") the given member
+func (z *SortedSet) rank(member, comparison string) (int64, error) {
+	originalMember := member
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	query := fmt.Sprintf("SELECT (SELECT COUNT(*) FROM %s o WHERE (o.%s, o.%s) %s (m.%s, m.%s)) FROM %s m WHERE m.%s = $1", z.table, scoreCol, setCol, comparison, scoreCol, setCol, z.table, setCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	var rank int64
+	err := z.host.db.QueryRow(query, member).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrValueNotFound, originalMember)
+	}
+	return rank, err
+}
+
+// Rank returns the position of a member when sorted from the lowest to the highest score, starting at 0, like ZRANK in Redis.
+// An error that wraps ErrValueNotFound is returned if the member is not in the sorted set.
+func (z *SortedSet) Rank(member string) (int64, error) {
+	return z.rank(member, "<")
+}
+
+// RevRank returns the position of a member when sorted from the highest to the lowest score, starting at 0, like ZREVRANK in Redis.
+// An error that wraps ErrValueNotFound is returned if the member is not in the sorted set.
+func (z *SortedSet) RevRank(member string) (int64, error) {
+	return z.rank(member, ">")
+}
+
+// rangeByRank returns the members from start to stop, in the given order
+func (z *SortedSet) rangeByRank(start, stop int, desc bool) ([]ScoredMember, error) {
+	if start < 0 || stop < 0 {
+		n, err := z.Card()
+		if err != nil {
+			return []ScoredMember{}, err
+		}
+		if start < 0 {
+			start += int(n)
+			if start < 0 {
+				start = 0
+			}
+		}
+		if stop < 0 {
+			stop += int(n)
+		}
+	}
+	if stop < start {
+		return []ScoredMember{}, nil
+	}
+	order := fmt.Sprintf("%s, %s", scoreCol, setCol)
+	if desc {
+		order = fmt.Sprintf("%s DESC, %s DESC", scoreCol, setCol)
+	}
+	return z.scored(fmt.Sprintf("SELECT %s, %s FROM %s ORDER BY %s LIMIT $1 OFFSET $2", setCol, scoreCol, z.table, order), stop-start+1, start)
+}
+
+// RangeByRank returns the members from rank start to rank stop, including both, sorted from the lowest
+// to the highest score, like ZRANGE in Redis. Negative ranks count from the end, where -1 is the member with the highest score.
+func (z *SortedSet) RangeByRank(start, stop int) ([]ScoredMember, error) {
+	return z.rangeByRank(start, stop, false)
+}
+
+// RevRangeByRank returns the members from rank start to rank stop, including both, sorted from the highest
+// to the lowest score, like ZREVRANGE in Redis. Useful for getting the top entries of a leaderboard.
+func (z *SortedSet) RevRangeByRank(start, stop int) ([]ScoredMember, error) {
+	return z.rangeByRank(start, stop, true)
+}
+
+// RangeByScore returns the members with a score from min to max, including both, sorted from the lowest
+// to the highest score, like ZRANGEBYSCORE in Redis. math.Inf can be used for ranges that are open in one end.
+func (z *SortedSet) RangeByScore(min, max float64) ([]ScoredMember, error) {
+	return z.scored(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s BETWEEN $1 AND $2 ORDER BY %s, %s", setCol, scoreCol, z.table, scoreCol, scoreCol, setCol), min, max)
+}
+
+// RemoveRangeByScore removes the members with a score from min to max, including both, like ZREMRANGEBYSCORE in Redis.
+// Returns the number of removed members.
+func (z *SortedSet) RemoveRangeByScore(min, max float64) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s BETWEEN $1 AND $2", z.table, scoreCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := z.host.db.Exec(query, min, max)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Count returns the number of members with a score from min to max, including both, like ZCOUNT in Redis
+func (z *SortedSet) Count(min, max float64) (int64, error) {
+	var count int64
+	err := z.host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s BETWEEN $1 AND $2", z.table, scoreCol), min, max).Scan(&count)
+	return count, err
+}
+
+// Card returns the number of members in the sorted set, like ZCARD in Redis
+func (z *SortedSet) Card() (int64, error) {
+	var count int64
+	err := z.host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", z.table)).Scan(&count)
+	return count, err
+}
+
+// pop removes and returns the member that is sorted first in the given order.
+// Members that are locked by other transactions are skipped, so that several consumers can pop from the same sorted set.
+func (z *SortedSet) pop(order string) (ScoredMember, error) {
+	members, err := z.scored(fmt.Sprintf("DELETE FROM %s WHERE %s = (SELECT %s FROM %s ORDER BY %s LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING %s, %s", z.table, setCol, setCol, z.table, order, setCol, scoreCol))
+	if err != nil {
+		return ScoredMember{}, err
+	}
+	if len(members) == 0 {
+		return ScoredMember{}, ErrNoAvailableValues
+	}
+	return members[0], nil
+}
+
+// PopMin removes and returns the member with the lowest score, like ZPOPMIN in Redis.
+// ErrNoAvailableValues is returned if the sorted set is empty.
+func (z *SortedSet) PopMin() (ScoredMember, error) {
+	return z.pop(fmt.Sprintf("%s, %s", scoreCol, setCol))
+}
+
+// PopMax removes and returns the member with the highest score, like ZPOPMAX in Redis.
+// ErrNoAvailableValues is returned if the sorted set is empty.
+func (z *SortedSet) PopMax() (ScoredMember, error) {
+	return z.pop(fmt.Sprintf("%s DESC, %s DESC", scoreCol, setCol))
+}
+
+// Del removes a member from the sorted set
+func (z *SortedSet) Del(member string) error {
+	if !z.host.rawUTF8 {
+		Encode(&member)
+	}
+	_, err := z.host.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = $1", z.table, setCol), member)
+	return err
+}
+
+// Remove this sorted set
+func (z *SortedSet) Remove() error {
+	// Remove the table
+	_, err := z.host.db.Exec(fmt.Sprintf("DROP TABLE %s", z.table))
+	return err
+}
+
+// Clear the sorted set contents
+func (z *SortedSet) Clear() error {
+	// Clear the table
+	_, err := z.host.db.Exec(fmt.Sprintf("TRUNCATE TABLE %s", z.table))
+	return err
+}
@@ -0,0 +1,97 @@
+package simplehstore
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSortedSet(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	leaderboard, err := NewCreator(host).NewSortedSet("sortedset_test_leaderboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderboard.Clear()
+	defer leaderboard.Remove()
+
+	for member, score := range map[string]float64{"alice": 30, "bob": 10, "carol": 20, "dave": 40} {
+		if err := leaderboard.Add(member, score); err != nil {
+			t.Error(err)
+		}
+	}
+	// Adding again updates the score
+	if err := leaderboard.Add("dave", 5); err != nil {
+		t.Error(err)
+	}
+	if score, err := leaderboard.IncrBy("bob", 25.5); err != nil || score != 35.5 {
+		t.Errorf("Error, expected 35.5, got %v (%v)", score, err)
+	}
+	if score, err := leaderboard.IncrBy("erin", 1); err != nil || score != 1 {
+		t.Errorf("Error, expected 1, got %v (%v)", score, err)
+	}
+	if score, err := leaderboard.Score("carol"); err != nil || score != 20 {
+		t.Errorf("Error, expected 20, got %v (%v)", score, err)
+	}
+	if _, err := leaderboard.Score("nobody"); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("Error, expected ErrValueNotFound, got: %v", err)
+	}
+
+	// erin 1, dave 5, carol 20, alice 30, bob 35.5
+	if rank, err := leaderboard.Rank("carol"); err != nil || rank != 2 {
+		t.Errorf("Error, expected rank 2, got %d (%v)", rank, err)
+	}
+	if rank, err := leaderboard.RevRank("bob"); err != nil || rank != 0 {
+		t.Errorf("Error, expected reverse rank 0, got %d (%v)", rank, err)
+	}
+	if _, err := leaderboard.Rank("nobody"); !errors.Is(err, ErrValueNotFound) {
+		t.Errorf("Error, expected ErrValueNotFound, got: %v", err)
+	}
+	members, err := leaderboard.RangeByRank(-2, -1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(members) != 2 || members[0] != (ScoredMember{"alice", 30}) || members[1] != (ScoredMember{"bob", 35.5}) {
+		t.Errorf("Error, unexpected range: %v", members)
+	}
+	members, err = leaderboard.RevRangeByRank(0, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(members) != 1 || members[0].Member != "bob" {
+		t.Errorf("Error, unexpected top entry: %v", members)
+	}
+	members, err = leaderboard.RangeByScore(5, 30)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(members) != 3 || members[0].Member != "dave" || members[2].Member != "alice" {
+		t.Errorf("Error, unexpected range by score: %v", members)
+	}
+	if count, err := leaderboard.Count(math.Inf(-1), 20); err != nil || count != 3 {
+		t.Errorf("Error, expected 3, got %d (%v)", count, err)
+	}
+
+	if n, err := leaderboard.RemoveRangeByScore(math.Inf(-1), 4); err != nil || n != 1 {
+		t.Errorf("Error, expected 1 removed member, got %d (%v)", n, err)
+	}
+	if member, err := leaderboard.PopMin(); err != nil || member.Member != "dave" {
+		t.Errorf("Error, expected dave, got %v (%v)", member, err)
+	}
+	if member, err := leaderboard.PopMax(); err != nil || member != (ScoredMember{"bob", 35.5}) {
+		t.Errorf("Error, expected bob, got %v (%v)", member, err)
+	}
+	if count, err := leaderboard.Card(); err != nil || count != 2 {
+		t.Errorf("Error, expected 2 members, got %d (%v)", count, err)
+	}
+	if err := leaderboard.Clear(); err != nil {
+		t.Error(err)
+	}
+	if _, err := leaderboard.PopMin(); err != ErrNoAvailableValues {
+		t.Errorf("Error, expected ErrNoAvailableValues, got: %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// The suffix for the name of the table with the consumer groups of a stream
+	streamGroupsSuffix = "_groups"
+	// The suffix for the name of the table with the pending entries of the consumer groups of a stream
+	streamPendingSuffix = "_pending"
+)
+
+// Stream is an append-only log of entries, where each entry is a map of fields, stored in PostgreSQL as an hstore.
+// Each entry has an ID that is higher than the IDs of all entries that were added before it.
+// Entries can be read by ID, or by consumer groups, that keep track of which entries each consumer has not acknowledged.
+type Stream struct {
+	host    *Host
+	table   string
+	groups  string
+	pending string
+}
+
+// StreamEntry is an entry in a Stream
+type StreamEntry struct {
+	ID      int64
+	Fields  map[string]string
+	AddedAt time.Time
+}
+
+// PendingEntry is an entry that has been delivered to a consumer in a consumer group, but not acknowledged
+type PendingEntry struct {
+	ID          int64
+	Consumer    string
+	DeliveredAt time.Time
+	Deliveries  int // the number of times the entry has been delivered
+}
+
+// NewStream creates a new stream
+func NewStream(host *Host, name string) (*Stream, error) {
+	s := &Stream{
+		host:    host,
+		table:   pq.QuoteIdentifier(name), // name is the name of the table
+		groups:  pq.QuoteIdentifier(name + streamGroupsSuffix),
+		pending: pq.QuoteIdentifier(name + streamPendingSuffix),
+	}
+
+	// Create extension hstore
+	query := "CREATE EXTENSION hstore"
+	// Ignore errors if hstore is already enabled
+	s.host.db.Exec(query)
+
+	for _, query := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGSERIAL PRIMARY KEY, fields hstore NOT NULL, %s TIMESTAMPTZ NOT NULL DEFAULT now())", s.table, pq.QuoteIdentifier(createdAtCol)),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (grp %s PRIMARY KEY, last_id BIGINT NOT NULL)", s.groups, defaultStringType),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (grp %s NOT NULL, id BIGINT NOT NULL, consumer %s NOT NULL, delivered_at TIMESTAMPTZ NOT NULL DEFAULT now(), deliveries INTEGER NOT NULL DEFAULT 1, PRIMARY KEY (grp, id))", s.pending, defaultStringType, defaultStringType),
+	} {
+		if _, err := s.host.db.Exec(query); err != nil {
+			if !strings.HasSuffix(err.Error(), "already exists") {
+				return nil, err
+			}
+		}
+	}
+	if Verbose {
+		log.Println("Created table " + s.table + " in database " + host.dbname)
+	}
+	return s, nil
+}
+
+// entries runs a query that returns entry IDs, fields as from hstore_to_array and times, and returns the decoded entries
+func (s *Stream) entries(query string, args ...interface{}) ([]StreamEntry, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	entries := []StreamEntry{}
+	rows, err := s.host.db.Query(query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			entry  StreamEntry
+			fields pq.StringArray
+		)
+		if err := rows.Scan(&entry.ID, &fields, &entry.AddedAt); err != nil {
+			return entries, err
+		}
+		entry.Fields = make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			value := fields[i+1]
+			if !s.host.rawUTF8 {
+				Decode(&value)
+			}
+			entry.Fields[fields[i]] = value
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// XAdd adds an entry to the end of the stream, like XADD in Redis, and returns the ID of the entry.
+// Consumers that wait in XRead or XReadGroup are notified.
+func (s *Stream) XAdd(fields map[string]string) (int64, error) {
+	keys := make([]string, 0, len(fields))
+	values := make([]string, 0, len(fields))
+	for k, v := range fields {
+		if !s.host.rawUTF8 {
+			Encode(&v)
+		}
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	var id int64
+	ctx := context.Background()
+	err := s.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		// Serialize XAdd calls for this stream, so that entries are committed in the order of their IDs,
+		// and readers that have seen an ID never miss an entry with a lower ID
+		if _, err := execWithTransaction(ctx, transaction, "SELECT pg_advisory_xact_lock(hashtext($1))", s.table); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("WITH i AS (INSERT INTO %s (fields) VALUES (hstore($1::text[], $2::text[])) RETURNING id) SELECT id FROM i, pg_notify($3, '')", s.table)
+		if Verbose {
+			fmt.Println(query)
+		}
+		return transaction.QueryRowContext(ctx, query, pq.Array(keys), pq.Array(values), notifyChannel(s.table)).Scan(&id)
+	})
+	return id, err
+}
+
+// XRange returns the entries with IDs from start to end, including both, sorted by ID, like XRANGE in Redis.
+// At most count entries are returned, or all of them if count is 0 or less.
+func (s *Stream) XRange(start, end int64, count int) ([]StreamEntry, error) {
+	return s.entries(fmt.Sprintf("SELECT id, hstore_to_array(fields), %s FROM %s WHERE id BETWEEN $1 AND $2 ORDER BY id%s", pq.QuoteIdentifier(createdAtCol), s.table, limitClause(count)), start, end)
+}
+
+// XRevRange returns the entries with IDs from end down to start, including both, sorted by ID in descending order,
+// like XREVRANGE in Redis. At most count entries are returned, or all of them if count is 0 or less.
+func (s *Stream) XRevRange(end, start int64, count int) ([]StreamEntry, error) {
+	return s.entries(fmt.Sprintf("SELECT id, hstore_to_array(fields), %s FROM %s WHERE id BETWEEN $1 AND $2 ORDER BY id DESC%s", pq.QuoteIdentifier(createdAtCol), s.table, limitClause(count)), start, end)
+}
+
+// limitClause returns a LIMIT clause for the given count, or nothing if count is 0 or less
+func limitClause(count int) string {
+	if count <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", count)
+}
+
+// XRead returns the entries with an ID higher than afterID, sorted by ID, like XREAD in Redis.
+// If there are no such entries, it waits until an entry is added, block has passed or the context is done.
+// A block of 0 means waiting until the context is done, like BLOCK 0 in Redis, and a negative block means not waiting.
+// An empty slice is returned if block passes.
+func (s *Stream) XRead(ctx context.Context, afterID int64, block time.Duration) ([]StreamEntry, error) {
+	return s.wait(ctx, block, func() ([]StreamEntry, error) {
+		return s.entries(fmt.Sprintf("SELECT id, hstore_to_array(fields), %s FROM %s WHERE id > $1 ORDER BY id", pq.QuoteIdentifier(createdAtCol), s.table), afterID)
+	})
+}
+
+// wait calls read until it returns entries or an error, block has passed or the context is done.
+// Waiting consumers are woken up by notifications from XAdd, and check the stream now and then in case notifications are lost.
+func (s *Stream) wait(ctx context.Context, block time.Duration, read func() ([]StreamEntry, error)) ([]StreamEntry, error) {
+	if block < 0 {
+		return read()
+	}
+	channel := notifyChannel(s.table)
+	// Subscribe before reading, so that no notification is missed
+	wake, unsubscribe := s.host.subscribe(channel)
+	defer unsubscribe()
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		entries, err := read()
+		if err != nil || len(entries) > 0 {
+			return entries, err
+		}
+		poll := time.NewTimer(s.host.pollInterval(channel))
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-deadline:
+			poll.Stop()
+			return []StreamEntry{}, nil
+		case <-ctx.Done():
+			poll.Stop()
+			return []StreamEntry{}, ctx.Err()
+		}
+		poll.Stop()
+	}
+}
+
+// XLen returns the number of entries in the stream, like XLEN in Redis
+func (s *Stream) XLen() (int64, error) {
+	var count int64
+	err := s.host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table)).Scan(&count)
+	return count, err
+}
+
+// LastID returns the ID of the last entry in the stream, or 0 if the stream is empty
+func (s *Stream) LastID() (int64, error) {
+	var id sql.NullInt64
+	err := s.host.db.QueryRow(fmt.Sprintf("SELECT MAX(id) FROM %s", s.table)).Scan(&id)
+	return id.Int64, err
+}
+
+// XDel removes entries from the stream, like XDEL in Redis. Returns the number of removed entries.
+func (s *Stream) XDel(ids ...int64) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = ANY($1::bigint[])", s.table)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := s.host.db.Exec(query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// XGroupCreate creates a consumer group that delivers the entries with an ID higher than afterID.
+// Use 0 for delivering all entries, or LastID for only delivering new entries.
+// An error that wraps ErrAlreadyExists is returned if the group already exists.
+func (s *Stream) XGroupCreate(group string, afterID int64) error {
+	query := fmt.Sprintf("INSERT INTO %s (grp, last_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", s.groups)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := s.host.db.Exec(query, group, afterID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, group)
+	}
+	return nil
+}
+
+// XGroupDestroy removes a consumer group, together with its pending entries
+func (s *Stream) XGroupDestroy(group string) error {
+	ctx := context.Background()
+	return s.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		if _, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE grp = $1", s.pending), group); err != nil {
+			return err
+		}
+		_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("DELETE FROM %s WHERE grp = $1", s.groups), group)
+		return err
+	})
+}
+
+// XReadGroup delivers up to count entries that have not been delivered to the consumer group before,
+// to the given consumer, like XREADGROUP in Redis. All entries are delivered if count is 0 or less.
+// The entries are pending until they are acknowledged with XAck. If there are no new entries,
+// it waits like XRead. An error that wraps ErrKeyDoesNotExist is returned if the group does not exist.
+func (s *Stream) XReadGroup(ctx context.Context, group, consumer string, count int, block time.Duration) ([]StreamEntry, error) {
+	return s.wait(ctx, block, func() ([]StreamEntry, error) {
+		// The group is locked, so that each entry is only delivered once, even with several consumers
+		query := fmt.Sprintf("WITH g AS (SELECT last_id FROM %s WHERE grp = $1 FOR UPDATE), "+
+			"e AS (SELECT s.id, s.fields, s.%s FROM %s s, g WHERE s.id > g.last_id ORDER BY s.id%s), "+
+			"p AS (INSERT INTO %s (grp, id, consumer) SELECT $1, id, $2 FROM e ON CONFLICT (grp, id) DO UPDATE SET consumer = EXCLUDED.consumer, delivered_at = now(), deliveries = %s.deliveries + 1), "+
+			"u AS (UPDATE %s SET last_id = (SELECT MAX(id) FROM e) WHERE grp = $1 AND EXISTS (SELECT 1 FROM e)) "+
+			"SELECT id, hstore_to_array(fields), %s FROM e ORDER BY id",
+			s.groups, pq.QuoteIdentifier(createdAtCol), s.table, limitClause(count), s.pending, s.pending, s.groups, pq.QuoteIdentifier(createdAtCol))
+		entries, err := s.entries(query, group, consumer)
+		if err != nil || len(entries) > 0 {
+			return entries, err
+		}
+		if err := s.checkGroup(group); err != nil {
+			return entries, err
+		}
+		return entries, nil
+	})
+}
+
+// checkGroup returns an error that wraps ErrKeyDoesNotExist if the consumer group does not exist
+func (s *Stream) checkGroup(group string) error {
+	var found bool
+	if err := s.host.db.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE grp = $1)", s.groups), group).Scan(&found); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrKeyDoesNotExist, group)
+	}
+	return nil
+}
+
+// XAck acknowledges that entries have been handled by the consumer group, and are no longer pending, like XACK in Redis.
+// Returns the number of entries that were pending.
+func (s *Stream) XAck(group string, ids ...int64) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE grp = $1 AND id = ANY($2::bigint[])", s.pending)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := s.host.db.Exec(query, group, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// XPending returns the entries that have been delivered to the consumer group, but not acknowledged, sorted by ID, like XPENDING in Redis
+func (s *Stream) XPending(group string) ([]PendingEntry, error) {
+	query := fmt.Sprintf("SELECT id, consumer, delivered_at, deliveries FROM %s WHERE grp = $1 ORDER BY id", s.pending)
+	if Verbose {
+		fmt.Println(query)
+	}
+	pending := []PendingEntry{}
+	rows, err := s.host.db.Query(query, group)
+	if err != nil {
+		return pending, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry PendingEntry
+		if err := rows.Scan(&entry.ID, &entry.Consumer, &entry.DeliveredAt, &entry.Deliveries); err != nil {
+			return pending, err
+		}
+		pending = append(pending, entry)
+	}
+	return pending, rows.Err()
+}
+
+// XClaim transfers pending entries that have not been acknowledged for at least minIdle to the given consumer,
+// and returns them, like XCLAIM in Redis. Useful for taking over the entries of consumers that have stopped.
+// Entries that are not pending, have been delivered more recently or have been removed from the stream are skipped.
+func (s *Stream) XClaim(group, consumer string, minIdle time.Duration, ids ...int64) ([]StreamEntry, error) {
+	query := fmt.Sprintf("WITH c AS (UPDATE %s SET consumer = $2, delivered_at = now(), deliveries = deliveries + 1 WHERE grp = $1 AND id = ANY($3::bigint[]) AND delivered_at <= now() - make_interval(secs => $4) RETURNING id) "+
+		"SELECT s.id, hstore_to_array(s.fields), s.%s FROM %s s JOIN c ON c.id = s.id ORDER BY s.id", s.pending, pq.QuoteIdentifier(createdAtCol), s.table)
+	return s.entries(query, group, consumer, pq.Array(ids), minIdle.Seconds())
+}
+
+// Remove this stream, together with its consumer groups
+func (s *Stream) Remove() error {
+	// Remove the tables
+	_, err := s.host.db.Exec(fmt.Sprintf("DROP TABLE %s, %s, %s", s.table, s.groups, s.pending))
+	return err
+}
+
+// Clear the stream contents, and the pending entries of the consumer groups. The consumer groups are kept.
+func (s *Stream) Clear() error {
+	// Clear the tables
+	_, err := s.host.db.Exec(fmt.Sprintf("TRUNCATE TABLE %s, %s", s.table, s.pending))
+	return err
+}
@@ -0,0 +1,162 @@
+package simplehstore
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	events, err := NewCreator(host).NewStream("stream_test_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Remove()
+	events.Clear()
+
+	var ids []int64
+	for _, name := range []string{"signup", "login", "logout"} {
+		id, err := events.XAdd(map[string]string{"event": name, "user": "bob"})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(ids) > 0 && id <= ids[len(ids)-1] {
+			t.Errorf("Error, expected increasing IDs, got %d after %v", id, ids)
+		}
+		ids = append(ids, id)
+	}
+	if n, err := events.XLen(); err != nil || n != 3 {
+		t.Errorf("Error, expected 3 entries, got %d (%v)", n, err)
+	}
+	if last, err := events.LastID(); err != nil || last != ids[2] {
+		t.Errorf("Error, expected %d as the last ID, got %d (%v)", ids[2], last, err)
+	}
+
+	entries, err := events.XRange(0, math.MaxInt64, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 2 || entries[0].Fields["event"] != "signup" || entries[1].Fields["event"] != "login" || entries[0].Fields["user"] != "bob" {
+		t.Errorf("Error, unexpected range: %v", entries)
+	}
+	entries, err = events.XRevRange(math.MaxInt64, ids[1], 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[2] || entries[1].ID != ids[1] {
+		t.Errorf("Error, unexpected reverse range: %v", entries)
+	}
+
+	ctx := context.Background()
+	entries, err = events.XRead(ctx, ids[0], -1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Error, expected 2 entries after the first one, got %v", entries)
+	}
+	if entries, err := events.XRead(ctx, ids[2], 50*time.Millisecond); err != nil || len(entries) != 0 {
+		t.Errorf("Error, expected no entries when the block time passes, got %v (%v)", entries, err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := events.XRead(cancelled, ids[2], 0); err != context.Canceled {
+		t.Errorf("Error, expected a block of 0 to wait until the context is done, got: %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := events.XAdd(map[string]string{"event": "purchase"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	entries, err = events.XRead(ctx, ids[2], 10*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 1 || entries[0].Fields["event"] != "purchase" {
+		t.Errorf("Error, expected the new entry, got %v", entries)
+	}
+}
+
+func TestStreamGroups(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	events, err := NewStream(host, "stream_test_groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Remove()
+	events.Clear()
+	events.XGroupDestroy("workers")
+
+	ctx := context.Background()
+	if _, err := events.XReadGroup(ctx, "workers", "alice", 0, -1); !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Errorf("Error, expected ErrKeyDoesNotExist, got: %v", err)
+	}
+	if err := events.XGroupCreate("workers", 0); err != nil {
+		t.Error(err)
+	}
+	if err := events.XGroupCreate("workers", 0); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := events.XAdd(map[string]string{"n": string(rune('a' + i))}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	alice, err := events.XReadGroup(ctx, "workers", "alice", 2, -1)
+	if err != nil {
+		t.Error(err)
+	}
+	bob, err := events.XReadGroup(ctx, "workers", "bob", 0, -1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(alice) != 2 || len(bob) != 1 || bob[0].Fields["n"] != "c" {
+		t.Fatalf("Error, each entry should be delivered once, got %v and %v", alice, bob)
+	}
+	if entries, err := events.XReadGroup(ctx, "workers", "bob", 0, -1); err != nil || len(entries) != 0 {
+		t.Errorf("Error, expected no new entries, got %v (%v)", entries, err)
+	}
+
+	if n, err := events.XAck("workers", alice[0].ID, bob[0].ID); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 acknowledged entries, got %d (%v)", n, err)
+	}
+	pending, err := events.XPending("workers")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(pending) != 1 || pending[0].ID != alice[1].ID || pending[0].Consumer != "alice" || pending[0].Deliveries != 1 {
+		t.Errorf("Error, unexpected pending entries: %v", pending)
+	}
+
+	// Bob takes over the entry that alice has not acknowledged
+	if claimed, err := events.XClaim("workers", "bob", time.Hour, alice[1].ID); err != nil || len(claimed) != 0 {
+		t.Errorf("Error, the entry has not been idle long enough to be claimed, got %v (%v)", claimed, err)
+	}
+	claimed, err := events.XClaim("workers", "bob", 0, alice[1].ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(claimed) != 1 || claimed[0].Fields["n"] != "b" {
+		t.Errorf("Error, unexpected claimed entries: %v", claimed)
+	}
+	pending, err = events.XPending("workers")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(pending) != 1 || pending[0].Consumer != "bob" || pending[0].Deliveries != 2 {
+		t.Errorf("Error, unexpected pending entries after claiming: %v", pending)
+	}
+}
@@ -0,0 +1,92 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The name of the column that keeps track of when elements were added to a TimestampedList
+const createdAtCol = "created_at"
+
+// TimestampedList is a List where each element has the time it was added,
+// so that elements can be looked up and removed by time. Useful for audit trails and event logs.
+type TimestampedList struct {
+	*List
+}
+
+// NewTimestampedList creates a new list where each element has the time it was added.
+// Existing list tables are upgraded with a column for the time. Elements that were
+// already in the list are given the time of the upgrade, since the time they were added is unknown.
+func NewTimestampedList(host *Host, name string) (*TimestampedList, error) {
+	l, err := NewList(host, name)
+	if err != nil {
+		return nil, err
+	}
+	tl := &TimestampedList{l}
+	if err := tl.createTimestampColumn(); err != nil {
+		return nil, err
+	}
+	return tl, nil
+}
+
+// createTimestampColumn adds the timestamp column and index, if they are missing
+func (tl *TimestampedList) createTimestampColumn() error {
+	found, err := tl.hasColumn(createdAtCol)
+	if err != nil || found {
+		return err
+	}
+	ctx := context.Background()
+	return tl.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+		for _, query := range []string{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s TIMESTAMPTZ NOT NULL DEFAULT now()", tl.table, pq.QuoteIdentifier(createdAtCol)),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", indexName(tl.table, createdAtCol), tl.table, pq.QuoteIdentifier(createdAtCol)),
+		} {
+			if _, err := execWithTransaction(ctx, transaction, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddAt adds an element to the end of the list, with the given time instead of the current time.
+// Consumers that wait in BlockingPopFront are notified.
+func (tl *TimestampedList) AddAt(value string, t time.Time) error {
+	if !tl.host.rawUTF8 {
+		Encode(&value)
+	}
+	query := fmt.Sprintf("WITH i AS (INSERT INTO %s (%s, %s) VALUES ($1, $2) RETURNING id) SELECT pg_notify($3, '') FROM i", tl.table, listCol, pq.QuoteIdentifier(createdAtCol))
+	if Verbose {
+		fmt.Println(query)
+	}
+	_, err := tl.host.db.Exec(query, value, t, notifyChannel(tl.table))
+	return err
+}
+
+// Since returns all elements that were added at the given time or later, sorted by time
+func (tl *TimestampedList) Since(t time.Time) ([]string, error) {
+	return tl.values(fmt.Sprintf("SELECT %s FROM %s WHERE %s >= $1 ORDER BY %s, %s", listCol, tl.table, pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol), listOrder()), t)
+}
+
+// Between returns all elements that were added at from or later, but before to, sorted by time
+func (tl *TimestampedList) Between(from, to time.Time) ([]string, error) {
+	return tl.values(fmt.Sprintf("SELECT %s FROM %s WHERE %s >= $1 AND %s < $2 ORDER BY %s, %s", listCol, tl.table, pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol), pq.QuoteIdentifier(createdAtCol), listOrder()), from, to)
+}
+
+// DeleteOlderThan removes all elements that were added before the given time.
+// Returns the number of removed elements.
+func (tl *TimestampedList) DeleteOlderThan(t time.Time) (int64, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s < $1", tl.table, pq.QuoteIdentifier(createdAtCol))
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := tl.host.db.Exec(query, t)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,73 @@
+package simplehstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/pinterface"
+)
+
+func TestTimestampedList(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	// Start with a regular list, and upgrade it
+	list, err := NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	list.Remove()
+	list, err = NewList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	if err := list.Add("old"); err != nil {
+		t.Error(err)
+	}
+	events, err := NewTimestampedList(host, listname)
+	if err != nil {
+		t.Error(err)
+	}
+	defer events.Remove()
+
+	now := time.Now()
+	hourAgo := now.Add(-time.Hour)
+	dayAgo := now.Add(-24 * time.Hour)
+	if err := events.AddAt("yesterday", dayAgo); err != nil {
+		t.Error(err)
+	}
+	if err := events.AddAt("an hour ago", hourAgo); err != nil {
+		t.Error(err)
+	}
+	if err := events.Add("now"); err != nil {
+		t.Error(err)
+	}
+
+	values, err := events.Since(now.Add(-2 * time.Hour))
+	if err != nil {
+		t.Error(err)
+	}
+	// The element from before the upgrade got the time of the upgrade
+	if strings.Join(values, ",") != "an hour ago,old,now" {
+		t.Errorf("Error, unexpected elements: %v", values)
+	}
+	values, err = events.Between(dayAgo, hourAgo)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Join(values, ",") != "yesterday" {
+		t.Errorf("Error, unexpected elements: %v", values)
+	}
+	if n, err := events.DeleteOlderThan(now.Add(-time.Minute)); err != nil || n != 2 {
+		t.Errorf("Error, expected 2 removed elements, got %d (%v)", n, err)
+	}
+	if values, err := events.All(); err != nil || strings.Join(values, ",") != "old,now" {
+		t.Errorf("Error, unexpected elements: %v (%v)", values, err)
+	}
+
+	// Check that the timestamped list qualifies for the IList interface
+	var _ pinterface.IList = events
+}
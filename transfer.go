@@ -0,0 +1,203 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// MergeStrategy decides what happens when an owner is merged into another hash map,
+// and both hash maps have the same key for that owner
+type MergeStrategy int
+
+const (
+	// MergeKeepSource overwrites the values in the destination with the values from the source
+	MergeKeepSource MergeStrategy = iota
+	// MergeKeepDestination keeps the values that already are in the destination
+	MergeKeepDestination
+	// MergeError makes the merge fail with an error that wraps ErrAlreadyExists
+	MergeError
+)
+
+// CopyOwnerTo copies all keys and values for an owner to another hash map, together with the expiry time, if any.
+// If the owner already exists in the destination, an error that wraps ErrAlreadyExists is returned.
+// This is done in a single transaction if both hash maps are on the same Host.
+func (h *HashMap) CopyOwnerTo(owner string, dst *HashMap) error {
+	return h.transferOwner(owner, dst, MergeError, true, false)
+}
+
+// MoveOwnerTo moves all keys and values for an owner to another hash map, together with the expiry time, if any.
+// If the owner already exists in the destination, an error that wraps ErrAlreadyExists is returned.
+// This is done in a single transaction if both hash maps are on the same Host. If not, the owner
+// is first stored in the destination, and then removed from this hash map.
+func (h *HashMap) MoveOwnerTo(owner string, dst *HashMap) error {
+	return h.transferOwner(owner, dst, MergeError, true, true)
+}
+
+// MergeOwner copies all keys and values for an owner to the same owner in another hash map,
+// which may already have some of the keys. The strategy decides which values are kept for those keys.
+// The expiry time of the owner in the destination, if any, is kept.
+// This is done in a single transaction if both hash maps are on the same Host.
+func (h *HashMap) MergeOwner(owner string, dst *HashMap, strategy MergeStrategy) error {
+	return h.transferOwner(owner, dst, strategy, false, false)
+}
+
+// transferOwner copies or moves an owner to another hash map
+func (h *HashMap) transferOwner(owner string, dst *HashMap, strategy MergeStrategy, mustBeNew, move bool) error {
+	ctx := context.Background()
+	if h.host == dst.host {
+		return h.host.withTransaction(ctx, func(transaction *sql.Tx) error {
+			// Lock the tables in the same order every time, to avoid deadlocks
+			tables := []string{h.table, dst.table}
+			if tables[1] < tables[0] {
+				tables[0], tables[1] = tables[1], tables[0]
+			}
+			for _, table := range tables {
+				if err := lockWithTransaction(ctx, transaction, table); err != nil {
+					return err
+				}
+			}
+			return h.transferOwnerWithTransactions(ctx, transaction, transaction, owner, dst, strategy, mustBeNew, move)
+		})
+	}
+	// The tables are not locked, since two Host structs may use the same database.
+	// The destination is committed before the source, so that nothing is lost if committing the source fails.
+	return h.host.withTransaction(ctx, func(srcTransaction *sql.Tx) error {
+		return dst.host.withTransaction(ctx, func(dstTransaction *sql.Tx) error {
+			return h.transferOwnerWithTransactions(ctx, srcTransaction, dstTransaction, owner, dst, strategy, mustBeNew, move)
+		})
+	})
+}
+
+// transferOwnerWithTransactions copies or moves an owner to another hash map, reading and removing
+// from this hash map with srcTransaction, and writing to the destination with dstTransaction
+func (h *HashMap) transferOwnerWithTransactions(ctx context.Context, srcTransaction, dstTransaction *sql.Tx, owner string, dst *HashMap, strategy MergeStrategy, mustBeNew, move bool) error {
+	if _, err := execWithTransaction(ctx, srcTransaction, h.purgeExpiredQuery(), h.table, owner); err != nil {
+		return err
+	}
+	if _, err := execWithTransaction(ctx, dstTransaction, dst.purgeExpiredQuery(), dst.table, owner); err != nil {
+		return err
+	}
+
+	// Read the keys and values from the source
+	query := fmt.Sprintf("SELECT e.key, e.value FROM %s, LATERAL each(attr) e WHERE %s = $1", h.table, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err := srcTransaction.QueryContext(ctx, query, owner)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]string)
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		m[key] = value.String
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	found, err := existsWithTransaction(ctx, srcTransaction, fmt.Sprintf("SELECT 1 FROM %s WHERE %s = $1", h.table, ownerCol), owner)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrOwnerDoesNotExist, owner)
+	}
+	var expiresAt sql.NullTime
+	if mustBeNew {
+		query = fmt.Sprintf("SELECT expires_at FROM %s WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable))
+		if err := srcTransaction.QueryRowContext(ctx, query, h.table, owner).Scan(&expiresAt); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	// Find the keys that the destination already has
+	found, err = existsWithTransaction(ctx, dstTransaction, fmt.Sprintf("SELECT 1 FROM %s WHERE %s = $1", dst.table, ownerCol), owner)
+	if err != nil {
+		return err
+	}
+	if found && mustBeNew {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, owner)
+	}
+	query = fmt.Sprintf("SELECT DISTINCT skeys(attr) FROM %s WHERE %s = $1", dst.table, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	rows, err = dstTransaction.QueryContext(ctx, query, owner)
+	if err != nil {
+		return err
+	}
+	var conflictingKeys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := m[key]; ok {
+			conflictingKeys = append(conflictingKeys, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(conflictingKeys) > 0 {
+		switch strategy {
+		case MergeKeepSource:
+			if err := dst.delKeysWithTransaction(ctx, dstTransaction, conflictingKeys, ownerCol+" = $2", owner); err != nil {
+				return err
+			}
+		case MergeKeepDestination:
+			for _, key := range conflictingKeys {
+				delete(m, key)
+			}
+		default:
+			return fmt.Errorf("%w: %s for %s", ErrAlreadyExists, conflictingKeys[0], owner)
+		}
+	}
+
+	// Store the keys and values in the destination, with one row per key, like Set
+	keys := make([]string, 0, len(m))
+	values := make([]string, 0, len(m))
+	for key, value := range m {
+		if h.host.rawUTF8 != dst.host.rawUTF8 {
+			if !h.host.rawUTF8 {
+				Decode(&value)
+			} else {
+				Encode(&value)
+			}
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if len(keys) > 0 {
+		query = fmt.Sprintf("INSERT INTO %s (%s, attr) SELECT $1, hstore(k, v) FROM unnest($2::text[], $3::text[]) AS input(k, v)", dst.table, ownerCol)
+		if _, err := execWithTransaction(ctx, dstTransaction, query, owner, pq.Array(keys), pq.Array(values)); err != nil {
+			return uniqueViolation(err, dst.Indexes(), keys...)
+		}
+	}
+	if expiresAt.Valid {
+		query = fmt.Sprintf("INSERT INTO %s (tbl, k, kind, expires_at) VALUES ($1, $2, $3, $4) ON CONFLICT (tbl, k) DO UPDATE SET expires_at = EXCLUDED.expires_at", pq.QuoteIdentifier(expiryTable))
+		if _, err := execWithTransaction(ctx, dstTransaction, query, dst.table, owner, expiryKindHashMap, expiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	if !move {
+		return nil
+	}
+	if _, err := execWithTransaction(ctx, srcTransaction, fmt.Sprintf("DELETE FROM %s WHERE %s = $1", h.table, ownerCol), owner); err != nil {
+		return err
+	}
+	_, err = execWithTransaction(ctx, srcTransaction, fmt.Sprintf("DELETE FROM %s WHERE tbl = $1 AND k = $2", pq.QuoteIdentifier(expiryTable)), h.table, owner)
+	return err
+}
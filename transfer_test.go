@@ -0,0 +1,106 @@
+package simplehstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHashMapTransferOwner(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	src, err := NewHashMap(host, "transfer_test_src")
+	if err != nil {
+		t.Error(err)
+	}
+	src.Clear()
+	defer src.Remove()
+	dst, err := NewHashMap(host, "transfer_test_dst")
+	if err != nil {
+		t.Error(err)
+	}
+	dst.Clear()
+	defer dst.Remove()
+
+	if err := src.SetMap("bob", map[string]string{"email": "bob@example.com", "name": "Bob"}); err != nil {
+		t.Error(err)
+	}
+	if err := src.ExpireOwner("bob", time.Hour); err != nil {
+		t.Error(err)
+	}
+
+	if err := src.CopyOwnerTo("nobody", dst); !errors.Is(err, ErrOwnerDoesNotExist) {
+		t.Errorf("Error, expected ErrOwnerDoesNotExist, got: %v", err)
+	}
+	if err := src.CopyOwnerTo("bob", dst); err != nil {
+		t.Error(err)
+	}
+	if err := src.CopyOwnerTo("bob", dst); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	m, err := dst.GetAll("bob")
+	if err != nil {
+		t.Error(err)
+	}
+	if m["email"] != "bob@example.com" || m["name"] != "Bob" {
+		t.Errorf("Error, unexpected copy: %v", m)
+	}
+	if _, err := host.ttl(dst.table, "bob", ownerCol+" = $2"); err != nil {
+		t.Errorf("Error, expected the expiry time to be copied: %v", err)
+	}
+	if exists, err := src.Exists("bob"); err != nil || !exists {
+		t.Errorf("Error, bob should still exist in the source (%v)", err)
+	}
+
+	// Merge
+	if err := src.Set("bob", "name", "Robert"); err != nil {
+		t.Error(err)
+	}
+	if err := src.Set("bob", "age", "42"); err != nil {
+		t.Error(err)
+	}
+	if err := src.MergeOwner("bob", dst, MergeError); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := src.MergeOwner("bob", dst, MergeKeepDestination); err != nil {
+		t.Error(err)
+	}
+	if name, err := dst.Get("bob", "name"); err != nil || name != "Bob" {
+		t.Errorf("Error, expected Bob, got %s (%v)", name, err)
+	}
+	if age, err := dst.Get("bob", "age"); err != nil || age != "42" {
+		t.Errorf("Error, expected 42, got %s (%v)", age, err)
+	}
+	if err := src.MergeOwner("bob", dst, MergeKeepSource); err != nil {
+		t.Error(err)
+	}
+	if name, err := dst.Get("bob", "name"); err != nil || name != "Robert" {
+		t.Errorf("Error, expected Robert, got %s (%v)", name, err)
+	}
+	// The rows in the destination that only had the replaced keys are gone
+	var emptyRows int
+	if err := host.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE attr = ''::hstore", dst.table)).Scan(&emptyRows); err != nil || emptyRows != 0 {
+		t.Errorf("Error, expected no empty rows, got %d (%v)", emptyRows, err)
+	}
+
+	// Move
+	if err := src.Set("carol", "email", "carol@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := src.MoveOwnerTo("bob", dst); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Error, expected ErrAlreadyExists, got: %v", err)
+	}
+	if err := src.MoveOwnerTo("carol", dst); err != nil {
+		t.Error(err)
+	}
+	if exists, err := src.Exists("carol"); err != nil || exists {
+		t.Errorf("Error, carol should no longer exist in the source (%v)", err)
+	}
+	if email, err := dst.Get("carol", "email"); err != nil || email != "carol@example.com" {
+		t.Errorf("Error, expected carol@example.com, got %s (%v)", email, err)
+	}
+}
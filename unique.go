@@ -0,0 +1,218 @@
+package simplehstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrUniqueViolation is used as an error if a value must be unique for a key, but is already used by another owner.
+// The returned errors are of the type *UniqueViolationError, which names the key.
+var ErrUniqueViolation = errors.New("unique violation")
+
+// UniqueViolationError is returned when a value must be unique for a key
+// (see HashMap.SetUniqueKey and HashMap2.SetUniqueKey), but is already used by another owner.
+// errors.Is(err, ErrUniqueViolation) is true for this error.
+type UniqueViolationError struct {
+	Key string
+}
+
+// Error returns the error message, which names the key
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("%s: the value for key %s is already used by another owner", ErrUniqueViolation, e.Key)
+}
+
+// Is makes errors.Is(err, ErrUniqueViolation) true for this error
+func (e *UniqueViolationError) Is(target error) bool {
+	return target == ErrUniqueViolation
+}
+
+// isUniqueViolation checks if the given error is a unique violation (SQLSTATE 23505) from PostgreSQL,
+// and returns the name of the violated constraint or index
+func isUniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
+
+// uniqueViolation converts a unique violation for one of the unique keys in the given table to a *UniqueViolationError.
+// Other errors are returned as they are.
+func uniqueViolation(err error, ix *Indexes, keys ...string) error {
+	constraint, ok := isUniqueViolation(err)
+	if !ok {
+		return err
+	}
+	for _, key := range keys {
+		if pq.QuoteIdentifier(constraint) == ix.uniqueKeyIndexName(key) {
+			return &UniqueViolationError{key}
+		}
+	}
+	return err
+}
+
+// SetUniqueKey makes sure that no two owners can have the same value for the given key,
+// by installing a partial unique index. Set, SetCheck and SetMap will then return a
+// *UniqueViolationError if the value is already used by another owner. Owners that have
+// expired, but have not been removed by the reaper yet, are removed to make room for the value.
+// If there already are duplicate values for the key, a *UniqueViolationError is returned.
+func (h *HashMap) SetUniqueKey(key string) error {
+	ix := h.Indexes()
+	err := ix.CreateUniqueKeyIndex(key)
+	if _, ok := isUniqueViolation(err); ok {
+		return &UniqueViolationError{key}
+	}
+	return err
+}
+
+// purgeExpiredOwnersWith removes the expired owners that have the given value for the given key,
+// but that have not been removed by the reaper yet. Returns true if any owners were removed.
+func (h *HashMap) purgeExpiredOwnersWith(key, value string) (bool, error) {
+	if !h.host.rawUTF8 {
+		Encode(&value)
+	}
+	query := fmt.Sprintf("WITH e AS (DELETE FROM %s x WHERE x.tbl = $1 AND x.expires_at <= now() AND x.k IN (SELECT %s FROM %s WHERE attr -> $2::text = $3) RETURNING x.k) DELETE FROM %s WHERE %s IN (SELECT k FROM e)", pq.QuoteIdentifier(expiryTable), ownerCol, h.table, h.table, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	result, err := h.host.db.Exec(query, h.table, key, value)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// retryUniqueViolation calls set, and if it returns a *UniqueViolationError because the value is used
+// by an owner that has expired, but has not been removed yet, that owner is removed and set is called again.
+// values are the values that set stores, by key.
+func (h *HashMap) retryUniqueViolation(values map[string]string, set func() error) error {
+	for {
+		err := set()
+		var violation *UniqueViolationError
+		if !errors.As(err, &violation) {
+			return err
+		}
+		purged, purgeErr := h.purgeExpiredOwnersWith(violation.Key, values[violation.Key])
+		if purgeErr != nil {
+			return purgeErr
+		}
+		if !purged {
+			return err
+		}
+	}
+}
+
+// RemoveUniqueKey allows several owners to have the same value for the given key again
+func (h *HashMap) RemoveUniqueKey(key string) error {
+	return h.Indexes().DropUniqueKeyIndex(key)
+}
+
+// name returns the name that was given to NewHashMap2
+func (hm2 *HashMap2) name() string {
+	return strings.TrimSuffix(hm2.table, hashMap2PropertiesSuffix)
+}
+
+// uniqueKeySet returns the *Set of keys that must have unique values
+func (hm2 *HashMap2) uniqueKeySet() *Set {
+	return &Set{hm2.host, pq.QuoteIdentifier(hm2.name() + "_unique_keys")}
+}
+
+// uniqueValuesTable returns the quoted name of the table that keeps track of which owner uses which unique value
+func (hm2 *HashMap2) uniqueValuesTable() string {
+	return pq.QuoteIdentifier(hm2.name() + "_unique_values")
+}
+
+// uniqueKeys returns the keys that must have unique values, if any
+func (hm2 *HashMap2) uniqueKeys() ([]string, error) {
+	keys, err := hm2.uniqueKeySet().All()
+	if noResult(err) {
+		// SetUniqueKey has never been called
+		return []string{}, nil
+	}
+	return keys, err
+}
+
+// SetUniqueKey makes sure that no two owners can have the same value for the given key.
+// Set and SetMap will then return a *UniqueViolationError if the value is already used by another owner.
+// If there already are duplicate values for the key, a *UniqueViolationError is returned.
+func (hm2 *HashMap2) SetUniqueKey(key string) error {
+	if _, err := NewSet(hm2.host, hm2.name()+"_unique_keys"); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (k %s NOT NULL, v %s NOT NULL, %s %s NOT NULL, PRIMARY KEY (k, v), UNIQUE (k, %s))", hm2.uniqueValuesTable(), defaultStringType, defaultStringType, ownerCol, defaultStringType, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := hm2.host.db.Exec(query); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	transaction, err := hm2.host.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Register all existing values for the key
+	table := pq.QuoteIdentifier(kvPrefix + hm2.table)
+	query = fmt.Sprintf("INSERT INTO %s (k, v, %s) SELECT $1, e.value, split_part(e.key, '%s', 1) FROM %s, LATERAL each(attr) e WHERE e.key LIKE $2 ON CONFLICT (k, %s) DO NOTHING", hm2.uniqueValuesTable(), ownerCol, fieldSep, table, ownerCol)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := transaction.ExecContext(ctx, query, key, "%"+escapeLike(fieldSep+key)); err != nil {
+		transaction.Rollback()
+		if _, ok := isUniqueViolation(err); ok {
+			return &UniqueViolationError{key}
+		}
+		return err
+	}
+	if err := transaction.Commit(); err != nil {
+		return err
+	}
+	return hm2.uniqueKeySet().Add(key)
+}
+
+// RemoveUniqueKey allows several owners to have the same value for the given key again
+func (hm2 *HashMap2) RemoveUniqueKey(key string) error {
+	if err := hm2.uniqueKeySet().Del(key); err != nil && !noResult(err) {
+		return err
+	}
+	return hm2.delUniqueValues("k = $1", key)
+}
+
+// claimUniqueValueWithTransaction registers that the given owner uses the given (unencoded) value for a unique key.
+// A *UniqueViolationError is returned if another owner already uses the value.
+func (hm2 *HashMap2) claimUniqueValueWithTransaction(ctx context.Context, transaction *sql.Tx, owner, key, value string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE k = $1 AND %s = $2", hm2.uniqueValuesTable(), ownerCol)
+	if _, err := transaction.ExecContext(ctx, query, key, owner); err != nil {
+		return err
+	}
+	if !hm2.host.rawUTF8 {
+		Encode(&value)
+	}
+	query = fmt.Sprintf("INSERT INTO %s (k, v, %s) VALUES ($1, $2, $3)", hm2.uniqueValuesTable(), ownerCol)
+	if _, err := transaction.ExecContext(ctx, query, key, value, owner); err != nil {
+		if _, ok := isUniqueViolation(err); ok {
+			return &UniqueViolationError{key}
+		}
+		return err
+	}
+	return nil
+}
+
+// delUniqueValues removes registered unique values, given an SQL condition.
+// Nothing is done if SetUniqueKey has never been called.
+func (hm2 *HashMap2) delUniqueValues(condition string, args ...interface{}) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", hm2.uniqueValuesTable(), condition)
+	if Verbose {
+		fmt.Println(query)
+	}
+	if _, err := hm2.host.db.Exec(query, args...); err != nil && !noResult(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package simplehstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHashMapUniqueKey(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap(host, "unique_test_users")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.SetUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("bob", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+	// Setting the same value again for the same owner is fine
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	err = users.Set("bob", "email", "alice@example.com")
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+	var uniqueErr *UniqueViolationError
+	if !errors.As(err, &uniqueErr) || uniqueErr.Key != "email" {
+		t.Errorf("Error, expected a *UniqueViolationError for email, got: %v", err)
+	}
+	if err := users.SetMap("carol", map[string]string{"name": "Carol", "email": "bob@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+	// Other keys may still have the same values
+	if err := users.Set("bob", "name", "Carol"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("carol", "name", "Carol"); err != nil {
+		t.Error(err)
+	}
+	if err := users.RemoveUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("bob", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	// There are now duplicates, so the key can not be made unique
+	if err := users.SetUniqueKey("email"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+}
+
+func TestHashMapUniqueKeyExpired(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap(host, "unique_test_expired")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.SetUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.ExpireOwner("alice", time.Millisecond); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// alice has expired, but has not been removed by the reaper, and should not block the value
+	if err := users.Set("bob", "email", "alice@example.com"); err != nil {
+		t.Errorf("Error, the value of an expired owner should be available, got: %v", err)
+	}
+	if exists, err := users.Exists("alice"); err != nil || exists {
+		t.Errorf("Error, alice should not exist (%v)", err)
+	}
+	if err := users.Set("carol", "email", "alice@example.com"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+}
+
+func TestHashMap2UniqueKey(t *testing.T) {
+	Verbose = true
+
+	host := NewHost(defaultConnectionString)
+	defer host.Close()
+
+	users, err := NewHashMap2(host, "unique_test_users2")
+	if err != nil {
+		t.Error(err)
+	}
+	users.Clear()
+	defer users.Remove()
+
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.SetUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("bob", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("alice", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	err = users.Set("bob", "email", "alice@example.com")
+	var uniqueErr *UniqueViolationError
+	if !errors.As(err, &uniqueErr) || uniqueErr.Key != "email" {
+		t.Errorf("Error, expected a *UniqueViolationError for email, got: %v", err)
+	}
+	// The failed Set must not have changed anything
+	if email, err := users.Get("bob", "email"); err != nil || email != "bob@example.com" {
+		t.Errorf("Error, expected bob@example.com, got %s (%v)", email, err)
+	}
+	// When alice changes her address, the old one is free again
+	if err := users.Set("alice", "email", "alice@example.org"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("carol", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	// The same goes for deleted keys and owners
+	if err := users.DelKey("carol", "email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Del("bob"); err != nil {
+		t.Error(err)
+	}
+	if err := users.SetMap("dave", map[string]string{"email": "alice@example.com", "name": "Dave"}); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("erin", "email", "bob@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.RemoveUniqueKey("email"); err != nil {
+		t.Error(err)
+	}
+	if err := users.Set("erin", "email", "alice@example.com"); err != nil {
+		t.Error(err)
+	}
+	if err := users.SetUniqueKey("email"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Error, expected a unique violation, got: %v", err)
+	}
+}
@@ -2,9 +2,16 @@ package simplehstore
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
+
+	"github.com/lib/pq"
 )
 
 // Verbose can be set to true when testing, for more information
@@ -173,3 +180,71 @@ func noResult(err error) bool {
 	msg := err.Error()
 	return strings.Contains(msg, "does not exist") || strings.Contains(msg, "no rows")
 }
+
+// indexName returns a deterministic name for an index, given a quoted table name and a description of the index.
+// The name is unique for each combination of table and description, and is never longer than what PostgreSQL allows.
+func indexName(table string, description ...string) string {
+	return pq.QuoteIdentifier(objectName(table, "idx", description...))
+}
+
+// objectName returns a deterministic, unquoted name for a database object that belongs to a table,
+// given a quoted table name, the kind of object and a description. The name ends with the kind.
+func objectName(table, kind string, description ...string) string {
+	table = strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(table, "\""), "\""), "\"\"", "\"")
+	sum := sha256.Sum256([]byte(table + "\x00" + strings.Join(description, "\x00")))
+	suffix := "_" + strings.Join(description, "_") + "_" + hex.EncodeToString(sum[:4]) + "_" + kind
+	// Keep the name within the 63 byte limit for identifiers
+	name := table + suffix
+	if len(name) > 63 {
+		name = table
+		if len(name) > 32 {
+			name = name[:32]
+		}
+		name += "_" + hex.EncodeToString(sum[:8]) + "_" + kind
+	}
+	return strings.ToValidUTF8(name, "")
+}
+
+// numericValue returns an SQL expression for the value of the given key in the attr column,
+// as a number. Values that are not numbers become NULL instead of causing errors.
+// The expression is immutable, so it can be used for expression indexes.
+func numericValue(key string) string {
+	return numericExpr(fmt.Sprintf("(attr -> '%s')", escapeSingleQuotes(key)))
+}
+
+// numericExpr returns an SQL expression that converts the given text expression to a number,
+// or to NULL if the text is not a number
+func numericExpr(v string) string {
+	return fmt.Sprintf("(CASE WHEN %s ~ '^\\s*[-+]?([0-9]+\\.?[0-9]*|\\.[0-9]+)([eE][-+]?[0-9]+)?\\s*$' THEN %s::numeric END)", v, v)
+}
+
+// escapeLike escapes a string so that it can be used literally in an SQL LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+// execWithTransaction executes a query as part of a transaction
+func execWithTransaction(ctx context.Context, transaction *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	if Verbose {
+		fmt.Println(query)
+	}
+	return transaction.ExecContext(ctx, query, args...)
+}
+
+// existsWithTransaction checks if the given query returns any rows, as part of a transaction
+func existsWithTransaction(ctx context.Context, transaction *sql.Tx, query string, args ...interface{}) (bool, error) {
+	query = fmt.Sprintf("SELECT EXISTS (%s)", query)
+	if Verbose {
+		fmt.Println(query)
+	}
+	var exists bool
+	err := transaction.QueryRowContext(ctx, query, args...).Scan(&exists)
+	return exists, err
+}
+
+// lockWithTransaction locks the given quoted table name against writes from other transactions,
+// until the transaction ends. Reading is still possible.
+func lockWithTransaction(ctx context.Context, transaction *sql.Tx, table string) error {
+	_, err := execWithTransaction(ctx, transaction, fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", table))
+	return err
+}
@@ -1,6 +1,7 @@
 package simplehstore
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -44,3 +45,17 @@ func TestCIDSN2(t *testing.T) {
 		t.Errorf("Error, the connection string could not be picked apart correctly:\n\t%s !=\n\t%s\ngiven %s", s, b, a)
 	}
 }
+
+func TestIndexName(t *testing.T) {
+	a := indexName(`"users"`, "num", "age")
+	if a != indexName(`"users"`, "num", "age") {
+		t.Error("Error, index names should be deterministic")
+	}
+	if a == indexName(`"users"`, "num", "score") || a == indexName(`"a_kv_users"`, "num", "age") {
+		t.Error("Error, index names should differ for different tables and descriptions")
+	}
+	long := indexName(`"`+strings.Repeat("x", 80)+`"`, "num", strings.Repeat("y", 80))
+	if len(long) > 63+2 {
+		t.Errorf("Error, the index name is too long: %s", long)
+	}
+}